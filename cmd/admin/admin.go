@@ -0,0 +1,168 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"github.com/paynejacob/hotcereal/pkg/provider"
+	"github.com/paynejacob/hotcereal/pkg/store"
+	"github.com/paynejacob/speakerbob/cmd/server"
+	"github.com/paynejacob/speakerbob/pkg/auth"
+	"github.com/paynejacob/speakerbob/pkg/blob"
+	"github.com/paynejacob/speakerbob/pkg/migration"
+	"github.com/paynejacob/speakerbob/pkg/sound"
+	"github.com/paynejacob/speakerbob/pkg/storage"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+var (
+	configPath string
+	dataPath   string
+)
+
+// data is the database the admin commands work on.
+var data struct {
+	store store.Store
+
+	tokens       *auth.TokenProvider
+	users        *auth.UserProvider
+	roleBindings *auth.RoleBindingProvider
+	sounds       *sound.SoundProvider
+	groups       *sound.GroupProvider
+}
+
+var Command = &cobra.Command{
+	Use:   "admin",
+	Short: "Manage the data of a stopped speakerbob server.",
+	Long: `Manage the data of a speakerbob server by opening its data directory directly. The server must be stopped
+first, the commands refuse to run while a server has the data directory open.`,
+}
+
+func init() {
+	Command.PersistentFlags().StringVar(&configPath, "config", "", "Path to the speakerbob server configuration file.")
+	Command.PersistentFlags().StringVar(&dataPath, "data-path", "", "Path to the data directory, overrides the configuration file.")
+}
+
+// withData opens the data directory while run runs.
+func withData(run func(args []string) error) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		// the arguments were valid, do not print usage for errors from here on
+		cmd.SilenceUsage = true
+
+		if err := open(); err != nil {
+			return err
+		}
+		defer data.store.Close()
+
+		return run(args)
+	}
+}
+
+// open opens the data directory and loads every provider.
+func open() error {
+	_store, err := openStore(false)
+	if err != nil {
+		return err
+	}
+
+	// only the server migrates, admin commands must not change the schema behind its back
+	if err = migration.Check(_store); err != nil {
+		_ = _store.Close()
+
+		if errors.Is(err, migration.ErrOlderSchema) {
+			return fmt.Errorf("%v, run speakerbob server --migrate-only first", err)
+		}
+
+		return err
+	}
+
+	blobs, err := openBlobStore()
+	if err != nil {
+		_ = _store.Close()
+		return err
+	}
+
+	lazyStore := blob.NewLazyStore(_store, blobs)
+
+	data.store = _store
+	data.tokens = &auth.TokenProvider{Store: lazyStore}
+	data.users = &auth.UserProvider{Store: lazyStore}
+	data.roleBindings = &auth.RoleBindingProvider{Store: lazyStore}
+	data.sounds = &sound.SoundProvider{Store: lazyStore}
+	data.groups = &sound.GroupProvider{Store: lazyStore}
+
+	for _, p := range []provider.Provider{data.tokens, data.users, data.roleBindings, data.sounds, data.groups} {
+		if err = p.Initialize(); err != nil {
+			_ = _store.Close()
+			return err
+		}
+	}
+
+	return nil
+}
+
+// openStore opens the data directory, refusing to open it while a server is using it. A missing data directory
+// is only created if create is set.
+func openStore(create bool) (store.Store, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = os.Stat(config.DataPath); err != nil && !(create && os.IsNotExist(err)) {
+		return nil, fmt.Errorf("unable to open data directory: %w", err)
+	}
+
+	_store, err := config.OpenStore()
+	if errors.Is(err, storage.ErrLocked) {
+		return nil, errors.New("the data directory is in use, stop the speakerbob server first")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return _store, nil
+}
+
+// openBlobStore returns the blob store the server keeps audio in.
+func openBlobStore() (blob.Store, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return config.OpenBlobStore()
+}
+
+func loadConfig() (server.Configuration, error) {
+	// never create a configuration file
+	if configPath != "" {
+		if _, err := os.Stat(configPath); err != nil {
+			return server.Configuration{}, err
+		}
+	}
+
+	config, err := server.ParseConfiguration(configPath)
+	if err != nil {
+		return config, err
+	}
+
+	if dataPath != "" {
+		config.DataPath = dataPath
+	}
+
+	return config, nil
+}
+
+func printTable(headers []string, rows [][]string) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(w, strings.Join(headers, "\t"))
+	for i := range rows {
+		_, _ = fmt.Fprintln(w, strings.Join(rows[i], "\t"))
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,231 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/paynejacob/speakerbob/cmd/client"
+	"github.com/paynejacob/speakerbob/pkg/backup"
+	_client "github.com/paynejacob/speakerbob/pkg/client"
+	"github.com/paynejacob/speakerbob/pkg/store/badgerdb"
+	"github.com/spf13/cobra"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var (
+	backupFile   string
+	restoreDry   bool
+	restoreForce bool
+)
+
+var BackupCommand = &cobra.Command{
+	Use:   "backup",
+	Short: "Back up the users, sounds, groups and audio of a speakerbob server.",
+	Long: `Back up a running speakerbob server through its api, the token must belong to an admin. Pass --server-config or
+--data-path to back up the data directory and blobs of a stopped server instead. The archive is verified once it is
+written.`,
+	Args: cobra.NoArgs,
+	RunE: runBackup,
+}
+
+var RestoreCommand = &cobra.Command{
+	Use:   "restore FILE",
+	Short: "Restore a backup into the data directory of a stopped speakerbob server.",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runRestore,
+}
+
+func init() {
+	client.AddFlags(BackupCommand)
+	BackupCommand.Flags().StringVarP(&backupFile, "file", "f", "", "Path to write the backup to, defaults to speakerbob-<timestamp>.tar, - writes to stdout.")
+	// --config is the client configuration of the api backup
+	BackupCommand.Flags().StringVar(&configPath, "server-config", "", "Path to the speakerbob server configuration file, backs up the stopped server instead of using the api.")
+	BackupCommand.Flags().StringVar(&dataPath, "data-path", "", "Back up the data directory of a stopped server instead of using the api, overrides the server configuration file.")
+
+	RestoreCommand.Flags().StringVar(&configPath, "config", "", "Path to the speakerbob server configuration file.")
+	RestoreCommand.Flags().StringVar(&dataPath, "data-path", "", "Path to the data directory, overrides the configuration file.")
+	RestoreCommand.Flags().BoolVar(&restoreDry, "dry-run", false, "Only verify the backup.")
+	RestoreCommand.Flags().BoolVar(&restoreForce, "force", false, "Delete the existing data before restoring.")
+}
+
+func runBackup(cmd *cobra.Command, _ []string) error {
+	cmd.SilenceUsage = true
+
+	write := backupAPI
+	if configPath != "" || dataPath != "" {
+		write = backupDataPath
+	}
+
+	if backupFile == "-" {
+		return write(os.Stdout)
+	}
+
+	path := backupFile
+	if path == "" {
+		path = fmt.Sprintf("speakerbob-%s.tar", time.Now().Format("20060102-150405"))
+	}
+
+	// write next to the destination so a failed backup never leaves a truncated archive behind
+	f, err := os.CreateTemp(filepath.Dir(path), ".speakerbob-backup-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+
+	if err = write(f); err != nil {
+		return err
+	}
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	manifest, keys, err := backup.Verify(f)
+	if err != nil {
+		return err
+	}
+
+	if err = os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+
+	fmt.Printf("wrote %s, %d keys and %d blobs (%s)\n", path, keys, manifest.Blobs, formatBytes(manifest.Size))
+
+	return nil
+}
+
+func backupAPI(w io.Writer) error {
+	cfg, err := client.Config()
+	if err != nil {
+		return err
+	}
+
+	if cfg.Server == "" {
+		return errors.New("no server configured, run speakerbob login or pass --server")
+	}
+
+	u, err := url.Parse(cfg.Server)
+	if err != nil {
+		return fmt.Errorf("invalid server url: %w", err)
+	}
+
+	return _client.New(u, cfg.Token).Backup(context.Background(), w)
+}
+
+func backupDataPath(w io.Writer) error {
+	_store, err := openBadger(false)
+	if err != nil {
+		return err
+	}
+	defer _store.Close()
+
+	blobs, err := openBlobStore()
+	if err != nil {
+		return err
+	}
+
+	_, err = backup.Write(w, _store.DB, blobs)
+
+	return err
+}
+
+func runRestore(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	manifest, keys, err := backup.Verify(f)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("backup of speakerbob %s created %s, %d keys and %d blobs (%s)\n",
+		manifest.Version, manifest.CreatedAt.Format(time.RFC3339), keys, manifest.Blobs, formatBytes(manifest.Size))
+
+	if restoreDry {
+		return nil
+	}
+
+	blobs, err := openBlobStore()
+	if err != nil {
+		return err
+	}
+
+	_store, err := openBadger(true)
+	if err != nil {
+		return err
+	}
+	defer _store.Close()
+
+	empty, err := isEmpty(_store.DB)
+	if err != nil {
+		return err
+	}
+
+	if !empty {
+		if !restoreForce {
+			return errors.New("the data directory is not empty, pass --force to replace its data")
+		}
+
+		if err = _store.DB.DropAll(); err != nil {
+			return err
+		}
+	}
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if _, err = backup.Restore(f, _store.DB, blobs); err != nil {
+		return err
+	}
+
+	fmt.Println("restored")
+
+	return nil
+}
+
+// openBadger opens the data directory, backups are only supported by the badger storage driver.
+func openBadger(create bool) (badgerdb.Store, error) {
+	_store, err := openStore(create)
+	if err != nil {
+		return badgerdb.Store{}, err
+	}
+
+	badgerStore, ok := _store.(badgerdb.Store)
+	if !ok {
+		_ = _store.Close()
+		return badgerdb.Store{}, errors.New("backups are only supported by the badger storage driver")
+	}
+
+	return badgerStore, nil
+}
+
+func isEmpty(db *badger.DB) (empty bool, err error) {
+	err = db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		it.Rewind()
+		empty = !it.Valid()
+
+		return nil
+	})
+
+	return
+}
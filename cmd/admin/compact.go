@@ -0,0 +1,40 @@
+package admin
+
+import (
+	"fmt"
+	"github.com/paynejacob/speakerbob/pkg/store/badgerdb"
+	"github.com/spf13/cobra"
+)
+
+var compactCommand = &cobra.Command{
+	Use:   "compact",
+	Short: "Reclaim the disk space of deleted sounds.",
+	Long: `Compact the data directory into a single level and rewrite the value log files holding deleted values. The
+server only rewrites value log files, run this after deleting many sounds to reclaim all of their space.`,
+	Args: cobra.NoArgs,
+	RunE: compact,
+}
+
+func init() {
+	Command.AddCommand(compactCommand)
+}
+
+func compact(cmd *cobra.Command, _ []string) error {
+	cmd.SilenceUsage = true
+
+	_store, err := openBadger(false)
+	if err != nil {
+		return err
+	}
+	defer _store.Close()
+
+	lsm, vlog := _store.DB.Size()
+
+	if err = badgerdb.Compact(_store.DB); err != nil {
+		return err
+	}
+
+	fmt.Printf("compacted, lsm size was %s and value log size was %s\n", formatBytes(lsm), formatBytes(vlog))
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package admin
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/paynejacob/speakerbob/cmd/server"
+	"github.com/paynejacob/speakerbob/pkg/blob"
+	"github.com/paynejacob/speakerbob/pkg/storage"
+	"github.com/paynejacob/speakerbob/pkg/store/badgerdb"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+var newKeyFile string
+
+var rotateKeyCommand = &cobra.Command{
+	Use:   "rotate-key",
+	Short: "Encrypt the data directory with a new key.",
+	Long: `Encrypt the data directory and the blobs on the filesystem with the key in --new-key-file. The current key
+is read from the configuration the same way the server reads it, a data directory without a key is encrypted for the
+first time. Update the configuration to use the new key before starting the server again.`,
+	Args: cobra.NoArgs,
+	RunE: rotateKey,
+}
+
+func init() {
+	rotateKeyCommand.Flags().StringVar(&newKeyFile, "new-key-file", "", "Path to a file holding the new 16, 24 or 32 byte key.")
+	_ = rotateKeyCommand.MarkFlagRequired("new-key-file")
+
+	Command.AddCommand(rotateKeyCommand)
+}
+
+func rotateKey(cmd *cobra.Command, _ []string) error {
+	cmd.SilenceUsage = true
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	if config.Storage.Driver != "" && config.Storage.Driver != storage.BadgerDriver {
+		return errors.New("encryption is only supported by the badger storage driver")
+	}
+
+	if _, err = os.Stat(config.DataPath); err != nil {
+		return fmt.Errorf("unable to open data directory: %w", err)
+	}
+
+	oldKey, err := config.EncryptionKey()
+	if err != nil {
+		return err
+	}
+
+	newKey, err := server.ReadKeyFile(newKeyFile)
+	if err != nil {
+		return err
+	}
+
+	if bytes.Equal(oldKey, newKey) {
+		return errors.New("the new key is the current key")
+	}
+
+	if err = badgerdb.ValidateKey(newKey); err != nil {
+		return err
+	}
+
+	// blobs are encrypted first, the rotation can be run again with the current key until the database is rotated
+	if err = rotateBlobKey(config, newKey); err != nil {
+		return err
+	}
+
+	if len(oldKey) == 0 {
+		err = badgerdb.Encrypt(config.DataPath, newKey)
+	} else {
+		err = badgerdb.RotateKey(config.DataPath, oldKey, newKey)
+	}
+	if errors.Is(err, storage.ErrLocked) {
+		return errors.New("the data directory is in use, stop the speakerbob server first")
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("encrypted with the new key, configure it before starting the server")
+
+	return nil
+}
+
+// rotateBlobKey encrypts the blobs on the filesystem with newKey, blobs in s3 are not encrypted by speakerbob.
+func rotateBlobKey(config server.Configuration, newKey []byte) (err error) {
+	// opening the data directory checks the current key, it stays locked so no server starts while blobs are rewritten
+	_store, err := openStore(false)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := _store.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	blobs, err := config.OpenBlobStore()
+	if err != nil {
+		return err
+	}
+
+	fileStore, ok := blobs.(blob.FileStore)
+	if !ok {
+		return nil
+	}
+
+	return fileStore.RotateKey(newKey)
+}
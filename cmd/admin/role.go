@@ -0,0 +1,64 @@
+package admin
+
+import (
+	"fmt"
+	"github.com/paynejacob/speakerbob/pkg/auth"
+	"github.com/spf13/cobra"
+)
+
+var roleCommand = &cobra.Command{
+	Use:   "roles",
+	Short: "Grant and revoke user roles.",
+}
+
+var roleGrantCommand = &cobra.Command{
+	Use:   "grant USER_ID ROLE",
+	Short: "Grant a role to a user.",
+	Args:  cobra.ExactArgs(2),
+	RunE:  withData(grantRole),
+}
+
+var roleRevokeCommand = &cobra.Command{
+	Use:   "revoke USER_ID ROLE",
+	Short: "Revoke a role from a user.",
+	Args:  cobra.ExactArgs(2),
+	RunE:  withData(revokeRole),
+}
+
+func init() {
+	roleCommand.AddCommand(roleGrantCommand, roleRevokeCommand)
+	Command.AddCommand(roleCommand)
+}
+
+func grantRole(args []string) error {
+	role := auth.Role(args[1])
+	if !auth.ValidRole(role) {
+		return fmt.Errorf("unknown role: %s, roles are %v", role, auth.Roles)
+	}
+
+	if data.users.Get(args[0]) == nil {
+		return fmt.Errorf("user not found: %s", args[0])
+	}
+
+	binding := data.roleBindings.Get(args[0])
+	if binding == nil {
+		binding = &auth.RoleBinding{Id: args[0]}
+	}
+
+	if !binding.Grant(role) {
+		return nil
+	}
+
+	return data.roleBindings.Save(binding)
+}
+
+func revokeRole(args []string) error {
+	binding := data.roleBindings.Get(args[0])
+	if !binding.Has(auth.Role(args[1])) {
+		return nil
+	}
+
+	binding.Revoke(auth.Role(args[1]))
+
+	return data.roleBindings.Save(binding)
+}
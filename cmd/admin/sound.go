@@ -0,0 +1,39 @@
+package admin
+
+import (
+	"fmt"
+	"github.com/paynejacob/speakerbob/pkg/sound"
+	"github.com/spf13/cobra"
+)
+
+var soundCommand = &cobra.Command{
+	Use:   "sounds",
+	Short: "Manage sounds.",
+}
+
+var soundDeleteCommand = &cobra.Command{
+	Use:   "delete SOUND_ID...",
+	Short: "Delete sounds and the groups they are in.",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  withData(deleteSounds),
+}
+
+func init() {
+	soundCommand.AddCommand(soundDeleteCommand)
+	Command.AddCommand(soundCommand)
+}
+
+func deleteSounds(args []string) error {
+	for i := range args {
+		s := data.sounds.Get(args[i])
+		if s == nil {
+			return fmt.Errorf("sound not found: %s", args[i])
+		}
+
+		if err := sound.DeleteSoundWithGroups(data.groups, data.sounds, s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
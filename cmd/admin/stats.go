@@ -0,0 +1,80 @@
+package admin
+
+import (
+	"fmt"
+	"github.com/paynejacob/speakerbob/pkg/migration"
+	"github.com/paynejacob/speakerbob/pkg/store/badgerdb"
+	"github.com/paynejacob/speakerbob/pkg/store/boltdb"
+	"github.com/spf13/cobra"
+	bolt "go.etcd.io/bbolt"
+	"strconv"
+)
+
+var statsCommand = &cobra.Command{
+	Use:   "stats",
+	Short: "Print the number of objects and the size of the data directory.",
+	Args:  cobra.NoArgs,
+	RunE:  withData(stats),
+}
+
+func init() {
+	Command.AddCommand(statsCommand)
+}
+
+func stats([]string) error {
+	var hidden int
+
+	sounds := data.sounds.List()
+	for i := range sounds {
+		if sounds[i].Hidden {
+			hidden++
+		}
+	}
+
+	version, err := migration.Version(data.store)
+	if err != nil {
+		return err
+	}
+
+	rows := [][]string{
+		{"schema version", strconv.Itoa(version)},
+		{"users", strconv.Itoa(len(data.users.List()))},
+		{"tokens", strconv.Itoa(len(data.tokens.List()))},
+		{"sounds", strconv.Itoa(len(sounds) - hidden)},
+		{"hidden sounds", strconv.Itoa(hidden)},
+		{"groups", strconv.Itoa(len(data.groups.List()))},
+	}
+
+	switch s := data.store.(type) {
+	case badgerdb.Store:
+		lsm, vlog := s.DB.Size()
+		rows = append(rows, []string{"lsm size", formatBytes(lsm)}, []string{"value log size", formatBytes(vlog)})
+	case boltdb.Store:
+		err = s.DB.View(func(tx *bolt.Tx) error {
+			rows = append(rows, []string{"database size", formatBytes(tx.Size())})
+			return nil
+		})
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return printTable([]string{"STAT", "VALUE"}, rows)
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,90 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"github.com/paynejacob/speakerbob/pkg/auth"
+	"github.com/spf13/cobra"
+	"time"
+)
+
+var revokeUserId string
+
+var tokenCommand = &cobra.Command{
+	Use:   "tokens",
+	Short: "Manage api tokens and sessions.",
+}
+
+var tokenListCommand = &cobra.Command{
+	Use:   "list",
+	Short: "List tokens.",
+	Args:  cobra.NoArgs,
+	RunE:  withData(listTokens),
+}
+
+var tokenRevokeCommand = &cobra.Command{
+	Use:   "revoke [TOKEN_ID]",
+	Short: "Revoke a token, or every token of a user.",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  withData(revokeTokens),
+}
+
+func init() {
+	tokenRevokeCommand.Flags().StringVar(&revokeUserId, "user", "", "Revoke every token of the user, signing them out everywhere.")
+
+	tokenCommand.AddCommand(tokenListCommand, tokenRevokeCommand)
+	Command.AddCommand(tokenCommand)
+}
+
+func listTokens([]string) error {
+	rows := make([][]string, 0)
+	for _, token := range data.tokens.List() {
+		expires := "never"
+		if !token.ExpiresAt.IsZero() {
+			expires = token.ExpiresAt.Format(time.RFC3339)
+		}
+
+		rows = append(rows, []string{token.Id, token.UserId, tokenType(token.Type), token.Name, expires})
+	}
+
+	return printTable([]string{"ID", "USER", "TYPE", "NAME", "EXPIRES"}, rows)
+}
+
+func revokeTokens(args []string) error {
+	var tokens []*auth.Token
+
+	switch {
+	case len(args) == 1 && revokeUserId == "":
+		token := data.tokens.Get(args[0])
+		if token == nil {
+			return fmt.Errorf("token not found: %s", args[0])
+		}
+
+		tokens = append(tokens, token)
+	case len(args) == 0 && revokeUserId != "":
+		tokens = userTokens(revokeUserId)
+	default:
+		return errors.New("either a token id or --user is required")
+	}
+
+	if err := data.tokens.Delete(tokens...); err != nil {
+		return err
+	}
+
+	fmt.Printf("revoked %d tokens\n", len(tokens))
+
+	return nil
+}
+
+func tokenType(t auth.TokenType) string {
+	switch t {
+	case auth.Session:
+		return "session"
+	case auth.Bearer:
+		return "bearer"
+	case auth.Websocket:
+		return "websocket"
+	}
+
+	return "invalid"
+}
@@ -0,0 +1,84 @@
+package admin
+
+import (
+	"fmt"
+	"github.com/paynejacob/speakerbob/pkg/auth"
+	"github.com/spf13/cobra"
+	"sort"
+	"strings"
+	"time"
+)
+
+var userCommand = &cobra.Command{
+	Use:   "users",
+	Short: "Manage users.",
+}
+
+var userListCommand = &cobra.Command{
+	Use:   "list",
+	Short: "List users.",
+	Args:  cobra.NoArgs,
+	RunE:  withData(listUsers),
+}
+
+var userDeleteCommand = &cobra.Command{
+	Use:   "delete USER_ID",
+	Short: "Delete a user with their tokens and roles.",
+	Args:  cobra.ExactArgs(1),
+	RunE:  withData(deleteUser),
+}
+
+func init() {
+	userCommand.AddCommand(userListCommand, userDeleteCommand)
+	Command.AddCommand(userCommand)
+}
+
+func listUsers([]string) error {
+	users := data.users.List()
+	sort.Slice(users, func(i, j int) bool { return users[i].CreatedAt.Before(users[j].CreatedAt) })
+
+	rows := make([][]string, 0, len(users))
+	for _, user := range users {
+		roles := make([]string, 0)
+		if binding := data.roleBindings.Get(user.Id); binding != nil {
+			for i := range binding.Roles {
+				roles = append(roles, string(binding.Roles[i]))
+			}
+		}
+
+		rows = append(rows, []string{user.Id, user.Email, user.Name(), strings.Join(roles, ","), user.CreatedAt.Format(time.RFC3339)})
+	}
+
+	return printTable([]string{"ID", "EMAIL", "NAME", "ROLES", "CREATED"}, rows)
+}
+
+func deleteUser(args []string) error {
+	user := data.users.Get(args[0])
+	if user == nil {
+		return fmt.Errorf("user not found: %s", args[0])
+	}
+
+	if err := data.tokens.Delete(userTokens(user.Id)...); err != nil {
+		return err
+	}
+
+	if binding := data.roleBindings.Get(user.Id); binding != nil {
+		if err := data.roleBindings.Delete(binding); err != nil {
+			return err
+		}
+	}
+
+	return data.users.Delete(user)
+}
+
+func userTokens(userId string) []*auth.Token {
+	tokens := make([]*auth.Token, 0)
+
+	for _, token := range data.tokens.List() {
+		if token.UserId == userId {
+			tokens = append(tokens, token)
+		}
+	}
+
+	return tokens
+}
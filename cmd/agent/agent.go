@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"context"
+	"github.com/paynejacob/speakerbob/cmd/client"
+	"github.com/paynejacob/speakerbob/pkg/agent"
+	api "github.com/paynejacob/speakerbob/pkg/client"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	cachePath   string
+	sinkCommand string
+	sinkFile    string
+)
+
+func init() {
+	Command.Flags().StringVar(&cachePath, "cache", "", "Directory to cache audio in, defaults to the user cache directory.")
+	Command.Flags().StringVar(&sinkCommand, "sink-command", "ffplay -nodisp -autoexit -loglevel quiet -", "Command that plays audio from stdin.")
+	Command.Flags().StringVar(&sinkFile, "sink-file", "", "Write audio to a file or named pipe instead of running a command.")
+	client.AddFlags(Command)
+}
+
+var Command = &cobra.Command{
+	Use:   "agent",
+	Short: "Play sounds from a speakerbob server.",
+	Long:  `Connect to a speakerbob server and play its sounds on this machine.`,
+	Run:   Agent,
+}
+
+func Agent(*cobra.Command, []string) {
+	cfg, err := client.Config()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	u, err := url.Parse(cfg.Server)
+	if err != nil || cfg.Server == "" {
+		logrus.Fatal("a valid server is required, run speakerbob login or pass --server")
+	}
+
+	if cachePath == "" {
+		userCache, err := os.UserCacheDir()
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		cachePath = filepath.Join(userCache, "speakerbob")
+	}
+
+	var sink agent.Sink = agent.CommandSink{Command: strings.Fields(sinkCommand)}
+	if sinkFile != "" {
+		sink = agent.FileSink{Path: sinkFile}
+	}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// watch for shutdown signals
+	go func() {
+		<-c
+		cancel()
+	}()
+
+	logrus.Info("Starting Speakerbob agent")
+	a := agent.Agent{
+		Client: api.New(u, cfg.Token),
+		Cache:  &agent.Cache{Path: cachePath},
+		Sink:   sink,
+	}
+	a.Run(ctx)
+}
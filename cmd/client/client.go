@@ -0,0 +1,154 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/paynejacob/speakerbob/pkg/client"
+	"github.com/spf13/cobra"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	tokenEnvironmentVariable = "SPEAKERBOB_TOKEN"
+
+	tableOutput = "table"
+	jsonOutput  = "json"
+)
+
+var (
+	configPath string
+	serverURL  string
+	token      string
+	output     string
+)
+
+// AddFlags adds the flags for the configuration file, server and token.
+func AddFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&configPath, "config", "", "Path to the client configuration file, defaults to ~/.speakerbob/config.yaml.")
+	cmd.PersistentFlags().StringVar(&serverURL, "server", "", "URL of the speakerbob server, overrides the configuration file.")
+	cmd.PersistentFlags().StringVar(&token, "token", "", "API token, overrides $"+tokenEnvironmentVariable+" and the configuration file.")
+}
+
+// clientCommand adds the flags every command that calls the api shares.
+func clientCommand(cmd *cobra.Command) *cobra.Command {
+	AddFlags(cmd)
+	cmd.PersistentFlags().StringVarP(&output, "output", "o", tableOutput, "Output format, table or json.")
+
+	// errors from the api are not usage errors
+	cmd.SilenceUsage = true
+	for _, c := range cmd.Commands() {
+		c.SilenceUsage = true
+	}
+
+	return cmd
+}
+
+// Config returns the saved configuration with the server and token given on the command line.
+func Config() (cfg client.Config, err error) {
+	path := configPath
+	if path == "" {
+		if path, err = client.DefaultConfigPath(); err != nil {
+			return
+		}
+	}
+
+	if cfg, err = client.LoadConfig(path); err != nil {
+		return
+	}
+
+	if serverURL != "" {
+		cfg.Server = serverURL
+	}
+
+	if t := os.Getenv(tokenEnvironmentVariable); t != "" {
+		cfg.Token = t
+	}
+
+	if token != "" {
+		cfg.Token = token
+	}
+
+	return
+}
+
+func newClient() (*client.Client, error) {
+	cfg, err := Config()
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Server == "" {
+		return nil, errors.New("no server configured, run speakerbob login or pass --server")
+	}
+
+	u, err := url.Parse(cfg.Server)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server url: %w", err)
+	}
+
+	return client.New(u, cfg.Token), nil
+}
+
+// render writes v as json, or as a table of rows when the output is a table.
+func render(v interface{}, headers []string, rows [][]string) error {
+	switch output {
+	case jsonOutput:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(v)
+	case tableOutput:
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+
+		_, _ = fmt.Fprintln(w, strings.Join(headers, "\t"))
+		for i := range rows {
+			_, _ = fmt.Fprintln(w, strings.Join(rows[i], "\t"))
+		}
+
+		return w.Flush()
+	}
+
+	return fmt.Errorf("unknown output format: %s", output)
+}
+
+var LoginCommand = &cobra.Command{
+	Use:   "login",
+	Short: "Save the server and token used by the client commands.",
+	Long:  `Save the server and token used by the client commands. Create a token in the web interface or with speakerbob token create.`,
+	Args:  cobra.NoArgs,
+	RunE:  Login,
+}
+
+func init() {
+	clientCommand(LoginCommand)
+}
+
+func Login(*cobra.Command, []string) error {
+	cfg, err := Config()
+	if err != nil {
+		return err
+	}
+
+	if _, err = url.Parse(cfg.Server); err != nil || cfg.Server == "" {
+		return errors.New("a valid --server is required")
+	}
+
+	path := configPath
+	if path == "" {
+		if path, err = client.DefaultConfigPath(); err != nil {
+			return err
+		}
+	}
+
+	if err = cfg.Save(path); err != nil {
+		return err
+	}
+
+	fmt.Printf("saved configuration to %s\n", path)
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package client
+
+import (
+	"context"
+	"github.com/spf13/cobra"
+	"strings"
+)
+
+var GroupCommand = &cobra.Command{
+	Use:   "group",
+	Short: "Manage and play groups of sounds.",
+	Long:  `Manage and play groups of sounds.`,
+}
+
+var groupCreateCommand = &cobra.Command{
+	Use:   "create NAME SOUND_ID SOUND_ID...",
+	Short: "Create a group that plays the sounds in order.",
+	Args:  cobra.MinimumNArgs(3),
+	RunE:  CreateGroup,
+}
+
+var groupPlayCommand = &cobra.Command{
+	Use:   "play GROUP_ID",
+	Short: "Play a group.",
+	Args:  cobra.ExactArgs(1),
+	RunE:  PlayGroup,
+}
+
+func init() {
+	GroupCommand.AddCommand(groupCreateCommand, groupPlayCommand)
+	clientCommand(GroupCommand)
+}
+
+func CreateGroup(_ *cobra.Command, args []string) error {
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	group, err := c.CreateGroup(context.Background(), args[0], args[1:])
+	if err != nil {
+		return err
+	}
+
+	return render(group, []string{"ID", "NAME", "SOUNDS"}, [][]string{{group.Id, group.Name, strings.Join(group.SoundIds, ",")}})
+}
+
+func PlayGroup(_ *cobra.Command, args []string) error {
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	return c.PlayGroup(context.Background(), args[0])
+}
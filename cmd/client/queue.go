@@ -0,0 +1,51 @@
+package client
+
+import (
+	"context"
+	"github.com/spf13/cobra"
+	"strings"
+)
+
+var SayCommand = &cobra.Command{
+	Use:   "say TEXT...",
+	Short: "Play text as speech.",
+	Long:  `Play text as speech.`,
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  Say,
+}
+
+var QueueCommand = &cobra.Command{
+	Use:   "queue",
+	Short: "List the sounds waiting to be played.",
+	Long:  `List the sounds waiting to be played.`,
+	Args:  cobra.NoArgs,
+	RunE:  Queue,
+}
+
+func init() {
+	clientCommand(SayCommand)
+	clientCommand(QueueCommand)
+}
+
+func Say(_ *cobra.Command, args []string) error {
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	return c.Say(context.Background(), strings.Join(args, " "))
+}
+
+func Queue(*cobra.Command, []string) error {
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	sounds, err := c.Queue(context.Background())
+	if err != nil {
+		return err
+	}
+
+	return renderSounds(sounds)
+}
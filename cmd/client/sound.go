@@ -0,0 +1,261 @@
+package client
+
+import (
+	"context"
+	"github.com/paynejacob/speakerbob/pkg/sound"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	uploadName   string
+	downloadPath string
+	exportPath   string
+)
+
+var SoundCommand = &cobra.Command{
+	Use:   "sound",
+	Short: "Manage and play sounds.",
+	Long:  `Manage and play sounds.`,
+}
+
+var soundListCommand = &cobra.Command{
+	Use:   "list",
+	Short: "List sounds.",
+	Args:  cobra.NoArgs,
+	RunE:  ListSounds,
+}
+
+var soundUploadCommand = &cobra.Command{
+	Use:   "upload FILE",
+	Short: "Upload a sound, named after the file unless a name is given.",
+	Args:  cobra.ExactArgs(1),
+	RunE:  UploadSound,
+}
+
+var soundRenameCommand = &cobra.Command{
+	Use:   "rename SOUND_ID NAME",
+	Short: "Rename a sound.",
+	Args:  cobra.ExactArgs(2),
+	RunE:  RenameSound,
+}
+
+var soundDeleteCommand = &cobra.Command{
+	Use:   "delete SOUND_ID",
+	Short: "Delete a sound and the groups it is in.",
+	Args:  cobra.ExactArgs(1),
+	RunE:  DeleteSound,
+}
+
+var soundPlayCommand = &cobra.Command{
+	Use:   "play SOUND_ID",
+	Short: "Play a sound.",
+	Args:  cobra.ExactArgs(1),
+	RunE:  PlaySound,
+}
+
+var soundDownloadCommand = &cobra.Command{
+	Use:   "download SOUND_ID",
+	Short: "Download a sound's audio.",
+	Args:  cobra.ExactArgs(1),
+	RunE:  DownloadSound,
+}
+
+var soundExportCommand = &cobra.Command{
+	Use:   "export",
+	Short: "Export every sound and group as a zip that can be imported into another server.",
+	Args:  cobra.NoArgs,
+	RunE:  ExportSounds,
+}
+
+var soundImportCommand = &cobra.Command{
+	Use:   "import FILE",
+	Short: "Import the sounds and groups of an export, sounds that already exist are skipped.",
+	Args:  cobra.ExactArgs(1),
+	RunE:  ImportSounds,
+}
+
+func init() {
+	soundUploadCommand.Flags().StringVar(&uploadName, "name", "", "Name of the sound.")
+	soundDownloadCommand.Flags().StringVarP(&downloadPath, "file", "f", "", "File to write the audio to, defaults to SOUND_ID.mp3. Use - for stdout.")
+	soundExportCommand.Flags().StringVarP(&exportPath, "file", "f", "speakerbob-sounds.zip", "File to write the export to. Use - for stdout.")
+
+	SoundCommand.AddCommand(soundListCommand, soundUploadCommand, soundRenameCommand, soundDeleteCommand, soundPlayCommand, soundDownloadCommand, soundExportCommand, soundImportCommand)
+	clientCommand(SoundCommand)
+}
+
+func ListSounds(*cobra.Command, []string) error {
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	sounds, err := c.ListSounds(context.Background())
+	if err != nil {
+		return err
+	}
+
+	return renderSounds(sounds)
+}
+
+func UploadSound(_ *cobra.Command, args []string) error {
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ctx := context.Background()
+
+	s, err := c.UploadSound(ctx, filepath.Base(args[0]), f)
+	if err != nil {
+		return err
+	}
+
+	// sounds are hidden until they are named
+	s.Name = uploadName
+	if s.Name == "" {
+		s.Name = strings.TrimSuffix(filepath.Base(args[0]), filepath.Ext(args[0]))
+	}
+
+	if err = c.RenameSound(ctx, s.Id, s.Name); err != nil {
+		return err
+	}
+
+	return renderSounds([]sound.Sound{*s})
+}
+
+func RenameSound(_ *cobra.Command, args []string) error {
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	return c.RenameSound(context.Background(), args[0], args[1])
+}
+
+func DeleteSound(_ *cobra.Command, args []string) error {
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	return c.DeleteSound(context.Background(), args[0])
+}
+
+func PlaySound(_ *cobra.Command, args []string) error {
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	return c.PlaySound(context.Background(), args[0])
+}
+
+func DownloadSound(_ *cobra.Command, args []string) error {
+	var w io.Writer = os.Stdout
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	path := downloadPath
+	if path == "" {
+		path = filepath.Base(args[0]) + ".mp3"
+	}
+
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		w = f
+	}
+
+	if err = c.DownloadSound(context.Background(), args[0], w); err != nil {
+		if path != "-" {
+			_ = os.Remove(path)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func ExportSounds(*cobra.Command, []string) error {
+	var w io.Writer = os.Stdout
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	if exportPath != "-" {
+		f, err := os.Create(exportPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		w = f
+	}
+
+	if err = c.ExportSounds(context.Background(), w); err != nil {
+		if exportPath != "-" {
+			_ = os.Remove(exportPath)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func ImportSounds(_ *cobra.Command, args []string) error {
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	result, err := c.ImportSounds(context.Background(), f)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(result.Sounds)+len(result.Groups))
+	for _, s := range result.Sounds {
+		rows = append(rows, []string{"sound", s.Id, s.Name})
+	}
+	for _, g := range result.Groups {
+		rows = append(rows, []string{"group", g.Id, g.Name})
+	}
+
+	return render(result, []string{"TYPE", "ID", "NAME"}, rows)
+}
+
+func renderSounds(sounds []sound.Sound) error {
+	rows := make([][]string, 0, len(sounds))
+	for i := range sounds {
+		rows = append(rows, []string{sounds[i].Id, sounds[i].Name, sounds[i].Duration.String()})
+	}
+
+	return render(sounds, []string{"ID", "NAME", "DURATION"}, rows)
+}
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"context"
+	"github.com/spf13/cobra"
+)
+
+var TokenCommand = &cobra.Command{
+	Use:   "token",
+	Short: "Manage api tokens.",
+	Long:  `Manage api tokens.`,
+}
+
+var tokenCreateCommand = &cobra.Command{
+	Use:   "create NAME",
+	Short: "Create an api token, the token is only shown once.",
+	Args:  cobra.ExactArgs(1),
+	RunE:  CreateToken,
+}
+
+func init() {
+	TokenCommand.AddCommand(tokenCreateCommand)
+	clientCommand(TokenCommand)
+}
+
+func CreateToken(_ *cobra.Command, args []string) error {
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	token, err := c.CreateToken(context.Background(), args[0])
+	if err != nil {
+		return err
+	}
+
+	return render(token, []string{"ID", "NAME", "TOKEN"}, [][]string{{token.Id, token.Name, token.AccessToken}})
+}
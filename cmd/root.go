@@ -2,6 +2,9 @@ package cmd
 
 import (
 	"fmt"
+	"github.com/paynejacob/speakerbob/cmd/admin"
+	"github.com/paynejacob/speakerbob/cmd/agent"
+	"github.com/paynejacob/speakerbob/cmd/client"
 	"github.com/paynejacob/speakerbob/cmd/server"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -30,6 +33,16 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&logLevelString, logLevelFlag, "info", "")
 
 	rootCmd.AddCommand(server.Command)
+	rootCmd.AddCommand(agent.Command)
+	rootCmd.AddCommand(admin.Command)
+	rootCmd.AddCommand(admin.BackupCommand)
+	rootCmd.AddCommand(admin.RestoreCommand)
+	rootCmd.AddCommand(client.LoginCommand)
+	rootCmd.AddCommand(client.SoundCommand)
+	rootCmd.AddCommand(client.GroupCommand)
+	rootCmd.AddCommand(client.SayCommand)
+	rootCmd.AddCommand(client.QueueCommand)
+	rootCmd.AddCommand(client.TokenCommand)
 
 	level, err := logrus.ParseLevel(logLevelString)
 	if err != nil {
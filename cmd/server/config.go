@@ -1,13 +1,28 @@
 package server
 
 import (
+	"errors"
+	"fmt"
+	"github.com/paynejacob/hotcereal/pkg/store"
 	"github.com/paynejacob/speakerbob/pkg/auth"
 	github "github.com/paynejacob/speakerbob/pkg/auth/github"
+	"github.com/paynejacob/speakerbob/pkg/blob"
+	"github.com/paynejacob/speakerbob/pkg/cluster"
+	"github.com/paynejacob/speakerbob/pkg/redis"
+	"github.com/paynejacob/speakerbob/pkg/storage"
+	"github.com/paynejacob/speakerbob/pkg/store/badgerdb"
+	"github.com/paynejacob/speakerbob/pkg/store/boltdb"
+	"github.com/paynejacob/speakerbob/pkg/store/redisdb"
 	"gopkg.in/yaml.v2"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
+// EncryptionKeyEnvironmentVariable sets the storage encryption key, it takes precedence over the configuration file.
+const EncryptionKeyEnvironmentVariable = "SPEAKERBOB_ENCRYPTION_KEY"
+
 type Configuration struct {
 	LogLevel string `yaml:"log_level"`
 
@@ -16,9 +31,38 @@ type Configuration struct {
 	DataPath string `yaml:"data_path"`
 
 	DurationLimit time.Duration `yaml:"duration_limit"`
+	PlayLeadTime  time.Duration `yaml:"play_lead_time"`
+
+	AllowedOrigins []string `yaml:"allowed_origins"`
+
+	Storage struct {
+		Driver storage.Driver `yaml:"driver"`
+
+		// the database and filesystem blobs are encrypted with the key or the content of the key file if either is set
+		Encryption struct {
+			Key     string `yaml:"key"`
+			KeyFile string `yaml:"key_file"`
+		} `yaml:"encryption"`
+	} `yaml:"storage"`
+
+	// Redis is the server used by the redis storage driver and clustering.
+	Redis redis.Options `yaml:"redis"`
+
+	// Cluster shares the queue and events of replicas that share their storage.
+	Cluster struct {
+		Enabled  bool          `yaml:"enabled"`
+		LeaseTTL time.Duration `yaml:"lease_ttl"`
+	} `yaml:"cluster"`
+
+	Blob struct {
+		Driver blob.Driver  `yaml:"driver"`
+		Path   string       `yaml:"path"`
+		S3     blob.S3Store `yaml:"s3"`
+	} `yaml:"blob"`
 
 	Auth struct {
-		Github github.Provider `yaml:"github"`
+		Github           github.Provider   `yaml:"github"`
+		GuestPermissions []auth.Permission `yaml:"guest_permissions"`
 	} `yaml:"auth"`
 
 	providers []auth.Provider
@@ -30,6 +74,13 @@ var DefaultConfiguration = Configuration{
 	Port:          80,
 	DataPath:      "/etc/speakerbob/data",
 	DurationLimit: 10 * time.Second,
+	PlayLeadTime:  500 * time.Millisecond,
+}
+
+func init() {
+	DefaultConfiguration.Storage.Driver = storage.BadgerDriver
+	DefaultConfiguration.Blob.Driver = blob.FilesystemDriver
+	DefaultConfiguration.Cluster.LeaseTTL = cluster.DefaultLeaseTTL
 }
 
 func (c Configuration) Providers() []auth.Provider {
@@ -40,7 +91,108 @@ func (c Configuration) Providers() []auth.Provider {
 	return c.providers
 }
 
-func parseConfiguration(configFilePath string) (cfg Configuration, err error) {
+// OpenStore opens the data directory with the configured storage driver, badger is used if no driver is set.
+func (c Configuration) OpenStore() (store.Store, error) {
+	key, err := c.EncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(key) > 0 && c.Storage.Driver != "" && c.Storage.Driver != storage.BadgerDriver {
+		return nil, errors.New("encryption is only supported by the badger storage driver")
+	}
+
+	switch c.Storage.Driver {
+	case "", storage.BadgerDriver:
+		return badgerdb.Open(c.DataPath, key)
+	case storage.BoltDriver:
+		return boltdb.Open(c.DataPath)
+	case storage.RedisDriver:
+		return redisdb.Open(c.Redis)
+	}
+
+	return nil, fmt.Errorf("unknown storage driver: %s, drivers are %v", c.Storage.Driver, storage.Drivers)
+}
+
+// EncryptionKey returns the storage encryption key from the environment, the key file or the configuration in that
+// order. The key is empty if the data directory is not encrypted.
+func (c Configuration) EncryptionKey() ([]byte, error) {
+	if key := os.Getenv(EncryptionKeyEnvironmentVariable); key != "" {
+		return []byte(key), nil
+	}
+
+	if c.Storage.Encryption.KeyFile != "" {
+		return ReadKeyFile(c.Storage.Encryption.KeyFile)
+	}
+
+	return []byte(c.Storage.Encryption.Key), nil
+}
+
+// ReadKeyFile reads an encryption key from a file, a trailing newline is not part of the key.
+func ReadKeyFile(path string) ([]byte, error) {
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read encryption key file: %w", err)
+	}
+
+	return []byte(strings.TrimRight(string(key), "\r\n")), nil
+}
+
+// OpenBlobStore returns the configured blob store, blobs are stored in the data directory if no driver is set. Blobs
+// stored on the filesystem are encrypted with the storage encryption key.
+func (c Configuration) OpenBlobStore() (blob.Store, error) {
+	switch c.Blob.Driver {
+	case "", blob.FilesystemDriver:
+		path := c.Blob.Path
+		if path == "" {
+			path = filepath.Join(c.DataPath, "blobs")
+		}
+
+		key, err := c.EncryptionKey()
+		if err != nil {
+			return nil, err
+		}
+
+		return blob.FileStore{Path: path, Key: key}, os.MkdirAll(path, 0700)
+	case blob.S3Driver:
+		if c.Blob.S3.Endpoint == "" || c.Blob.S3.Bucket == "" {
+			return nil, errors.New("the s3 blob driver requires an endpoint and bucket")
+		}
+
+		return c.Blob.S3, nil
+	}
+
+	return nil, fmt.Errorf("unknown blob driver: %s, drivers are %v", c.Blob.Driver, blob.Drivers)
+}
+
+// OpenCluster connects to the other replicas, the cluster is nil if clustering is not enabled. Replicas must share
+// their storage so the storage and blob drivers must be redis and s3.
+func (c Configuration) OpenCluster() (*cluster.Cluster, error) {
+	if !c.Cluster.Enabled {
+		return nil, nil
+	}
+
+	if c.Storage.Driver != storage.RedisDriver || c.Blob.Driver != blob.S3Driver {
+		return nil, errors.New("clustering requires the redis storage driver and the s3 blob driver")
+	}
+
+	client := redis.NewClient(c.Redis)
+	if _, err := client.Do("PING"); err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("unable to connect to redis: %w", err)
+	}
+
+	pubSub := cluster.RedisPubSub{Client: client}
+	elector := &cluster.RedisElector{Client: client, TTL: c.Cluster.LeaseTTL}
+
+	cl := cluster.New(pubSub, elector)
+	elector.Id = cl.Id
+
+	return cl, nil
+}
+
+// ParseConfiguration reads the configuration file, a missing file is created with the default configuration.
+func ParseConfiguration(configFilePath string) (cfg Configuration, err error) {
 	var f *os.File
 
 	if configFilePath == "" {
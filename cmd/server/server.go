@@ -4,21 +4,25 @@ package server
 
 import (
 	"context"
-	"github.com/dgraph-io/badger/v3"
 	"github.com/paynejacob/hotcereal/pkg/store"
+	"github.com/paynejacob/speakerbob/pkg/blob"
+	"github.com/paynejacob/speakerbob/pkg/cluster"
+	"github.com/paynejacob/speakerbob/pkg/migration"
 	"github.com/paynejacob/speakerbob/pkg/server"
-	"github.com/paynejacob/speakerbob/pkg/store/badgerdb"
-	"github.com/paynejacob/speakerbob/pkg/version"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"os"
 	"os/signal"
 )
 
-var configPath string
+var (
+	configPath  string
+	migrateOnly bool
+)
 
 func init() {
 	Command.PersistentFlags().StringVar(&configPath, "config", "", "Path to a speakerbob server configuration file.")
+	Command.Flags().BoolVar(&migrateOnly, "migrate-only", false, "Migrate the data to the latest schema and exit.")
 }
 
 var Command = &cobra.Command{
@@ -30,7 +34,7 @@ var Command = &cobra.Command{
 
 func Server(*cobra.Command, []string) {
 	// load configuration
-	config, err := parseConfiguration(configPath)
+	config, err := ParseConfiguration(configPath)
 	if err != nil {
 		logrus.Fatal(err)
 	}
@@ -43,20 +47,46 @@ func Server(*cobra.Command, []string) {
 	logrus.SetLevel(level)
 
 	// setup the store
-	badgerdbOptions := badger.DefaultOptions(config.DataPath)
-	badgerdbOptions.Logger = logrus.StandardLogger()
-	db, err := badger.Open(badgerdbOptions)
+	_store, err := config.OpenStore()
 	if err != nil {
 		logrus.Fatal(err)
 	}
 
-	_store := badgerdb.Store{
-		DB: db,
+	// migrate before the providers load the data
+	if err = migration.Run(_store); err != nil {
+		_ = _store.Close()
+		logrus.Fatal(err)
 	}
 
-	err = _store.Save(store.TypeKey{"versionVersion", 7, 7}, []byte(version.Version))
+	if migrateOnly {
+		logrus.Infof("Data is at schema version %d", migration.Latest())
+
+		if err = _store.Close(); err != nil {
+			logrus.Fatal(err)
+		}
+
+		return
+	}
+
+	// audio is kept out of the store
+	blobs, err := config.OpenBlobStore()
 	if err != nil {
-		logrus.Fatal("failed to set database version")
+		_ = _store.Close()
+		logrus.Fatal(err)
+	}
+
+	// replicas share their storage, changes are announced so the others refresh their caches
+	var sharedStore store.Store = _store
+
+	cl, err := config.OpenCluster()
+	if err != nil {
+		_ = _store.Close()
+		logrus.Fatal(err)
+	}
+
+	if cl != nil {
+		logrus.Infof("Joining the cluster as replica %s", cl.Id)
+		sharedStore = cluster.NewStore(_store, cl)
 	}
 
 	c := make(chan os.Signal, 1)
@@ -70,11 +100,18 @@ func Server(*cobra.Command, []string) {
 	}()
 
 	logrus.Info("Starting Speakerbob server")
-	s := server.NewServer(_store, server.Config{
+	s := server.NewServer(blob.NewLazyStore(sharedStore, blobs), server.Config{
 		Host:          config.Host,
 		Port:          config.Port,
 		DurationLimit: config.DurationLimit,
+		PlayLeadTime:  config.PlayLeadTime,
 		AuthProviders: config.Providers(),
+
+		GuestPermissions: config.Auth.GuestPermissions,
+
+		AllowedOrigins: config.AllowedOrigins,
+
+		Cluster: cl,
 	})
 	if err = s.Run(ctx); err != nil {
 		logrus.Errorf("server exited unexpectedly: %s", err.Error())
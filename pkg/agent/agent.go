@@ -0,0 +1,250 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"github.com/paynejacob/speakerbob/pkg/client"
+	"github.com/paynejacob/speakerbob/pkg/sound"
+	speakerbob "github.com/paynejacob/speakerbob/pkg/websocket"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+
+	// plays waiting for the sink, more are dropped
+	playBufferSize = 16
+
+	clockSyncCommandId = "clock_sync"
+
+	clientName = "agent"
+)
+
+// Agent plays the sounds played on a server through a sink.
+type Agent struct {
+	Client *client.Client
+	Cache  *Cache
+	Sink   Sink
+}
+
+// message is the part of every server message the agent needs to route it.
+type message struct {
+	Type speakerbob.MessageType `json:"type"`
+	Id   string                 `json:"id"`
+	Body json.RawMessage        `json:"body"`
+}
+
+type clockSyncResponse struct {
+	ClientTime     int64 `json:"client_time"`
+	ServerReceive  int64 `json:"server_receive"`
+	ServerTransmit int64 `json:"server_transmit"`
+}
+
+// conn serializes writes to the websocket between the reader and the player.
+type conn struct {
+	ws *websocket.Conn
+	m  sync.Mutex
+}
+
+func (c *conn) send(commandType speakerbob.CommandType, id string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.ws.WriteJSON(speakerbob.CommandMessage{Id: id, Type: commandType, Body: data})
+}
+
+// Run plays sounds until ctx is done, reconnecting with backoff when the connection is lost.
+func (a *Agent) Run(ctx context.Context) {
+	backoff := minBackoff
+
+	for {
+		connected, err := a.session(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if connected {
+			backoff = minBackoff
+		}
+
+		logrus.Warnf("[agent] connection lost: %v, reconnecting in %s", err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// session plays sounds until the connection is lost, connected is false if the connection could not be opened.
+func (a *Agent) session(ctx context.Context) (connected bool, err error) {
+	header := http.Header{}
+	if a.Client.Token != "" {
+		header.Set("Authorization", "Bearer "+a.Client.Token)
+	}
+
+	ws, _, err := websocket.DefaultDialer.DialContext(ctx, a.websocketURL(), header)
+	if err != nil {
+		return false, err
+	}
+	defer ws.Close()
+
+	logrus.Infof("[agent] connected to %s", a.Client.Server)
+
+	c := &conn{ws: ws}
+
+	// unblock the reader when we are stopped
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = ws.Close()
+		case <-done:
+		}
+	}()
+
+	plays := make(chan sound.PlayMessage, playBufferSize)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for play := range plays {
+			a.play(ctx, c, play)
+		}
+	}()
+	defer wg.Wait()
+	defer close(plays)
+
+	if err = c.send(speakerbob.ClockSyncCommandType, clockSyncCommandId, map[string]int64{"client_time": unixMilli(time.Now())}); err != nil {
+		return true, err
+	}
+
+	for {
+		var msg message
+		var data []byte
+
+		if _, data, err = ws.ReadMessage(); err != nil {
+			return true, err
+		}
+
+		if err = json.Unmarshal(data, &msg); err != nil {
+			logrus.Warnf("[agent] unable to parse message: %v", err)
+			continue
+		}
+
+		switch msg.Type {
+		case speakerbob.PlayMessageType:
+			var play sound.PlayMessage
+
+			if err = json.Unmarshal(data, &play); err != nil {
+				logrus.Warnf("[agent] unable to parse play message: %v", err)
+				continue
+			}
+
+			select {
+			case plays <- play:
+			default:
+				logrus.Warnf("[agent] dropping %s, too many sounds waiting to play", play.Sound.Id)
+			}
+		case speakerbob.AckMessageType:
+			if msg.Id != clockSyncCommandId {
+				continue
+			}
+
+			if err = c.send(speakerbob.ClockOffsetCommandType, "", map[string]int64{"offset": clockOffset(msg.Body, time.Now())}); err != nil {
+				return true, err
+			}
+		case speakerbob.ErrorMessageType:
+			logrus.Warnf("[agent] server error: %s", string(data))
+		}
+	}
+}
+
+// play waits for the scheduled time and plays the sound, reporting the playback to the server.
+func (a *Agent) play(ctx context.Context, c *conn, play sound.PlayMessage) {
+	audio, err := a.Cache.Open(ctx, play.Sound.Id, a.Client.DownloadSound)
+	if err != nil {
+		logrus.Errorf("[agent] failed to download %s: %v", play.Sound.Id, err)
+		a.report(c, play.PlayId, sound.FailedPlaybackStatus)
+		return
+	}
+	defer audio.Close()
+
+	start := play.Scheduled.Add(time.Duration(play.ClockOffset) * time.Millisecond)
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(time.Until(start)):
+	}
+
+	a.report(c, play.PlayId, sound.StartedPlaybackStatus)
+
+	if err = a.Sink.Play(ctx, audio); err != nil {
+		logrus.Errorf("[agent] failed to play %s: %v", play.Sound.Id, err)
+		a.report(c, play.PlayId, sound.FailedPlaybackStatus)
+		return
+	}
+
+	a.report(c, play.PlayId, sound.FinishedPlaybackStatus)
+}
+
+func (a *Agent) report(c *conn, playId string, status sound.PlaybackStatus) {
+	err := c.send(speakerbob.PlaybackCommandType, "", map[string]interface{}{"play_id": playId, "status": status})
+	if err != nil {
+		logrus.Debugf("[agent] failed to report playback: %v", err)
+	}
+}
+
+func (a *Agent) websocketURL() string {
+	u := *a.Client.Server
+
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	default:
+		u.Scheme = "ws"
+	}
+
+	u.Path = "/ws/"
+	u.RawQuery = url.Values{
+		"client":   []string{clientName},
+		"channels": []string{"playback"},
+	}.Encode()
+
+	return u.String()
+}
+
+// clockOffset returns how far our clock is ahead of the server's from the clock_sync ack.
+func clockOffset(body json.RawMessage, received time.Time) int64 {
+	var resp clockSyncResponse
+
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return 0
+	}
+
+	return ((resp.ClientTime - resp.ServerReceive) + (unixMilli(received) - resp.ServerTransmit)) / 2
+}
+
+func unixMilli(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
@@ -0,0 +1,134 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/paynejacob/speakerbob/pkg/client"
+	"github.com/paynejacob/speakerbob/pkg/sound"
+	speakerbob "github.com/paynejacob/speakerbob/pkg/websocket"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testToken = "foobar"
+
+// newServer plays a single sound to the first connection and sends the commands it receives to commands.
+func newServer(commands chan speakerbob.CommandMessage, downloads *int32) *httptest.Server {
+	var upgrader websocket.Upgrader
+
+	router := mux.NewRouter()
+	router.HandleFunc("/ws/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+
+		_ = ws.WriteJSON(sound.PlayMessage{
+			Type:      speakerbob.PlayMessageType,
+			PlayId:    "p1",
+			Sound:     sound.Sound{Id: "s1"},
+			Scheduled: time.Now().Add(50 * time.Millisecond),
+		})
+
+		for {
+			var msg speakerbob.CommandMessage
+
+			if err = ws.ReadJSON(&msg); err != nil {
+				return
+			}
+
+			commands <- msg
+		}
+	})
+	router.HandleFunc("/api/sound/sounds/{soundId}/download/", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(downloads, 1)
+		_, _ = w.Write([]byte("audio-" + mux.Vars(r)["soundId"]))
+	})
+
+	return httptest.NewServer(router)
+}
+
+func TestAgent(t *testing.T) {
+	var downloads int32
+
+	commands := make(chan speakerbob.CommandMessage, 16)
+
+	sut := newServer(commands, &downloads)
+	defer sut.Close()
+
+	u, _ := url.Parse(sut.URL)
+	dir := t.TempDir()
+	output := filepath.Join(dir, "output")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a := Agent{
+		Client: client.New(u, testToken),
+		Cache:  &Cache{Path: filepath.Join(dir, "cache")},
+		Sink:   FileSink{Path: output},
+	}
+	go a.Run(ctx)
+
+	// the clock is synced on connect
+	msg := <-commands
+	assert.Equal(t, speakerbob.ClockSyncCommandType, msg.Type)
+
+	statuses := make([]sound.PlaybackStatus, 0)
+	timeout := time.After(time.Second)
+	for len(statuses) < 2 {
+		select {
+		case msg = <-commands:
+		case <-timeout:
+			t.Fatal("timed out waiting for playback reports")
+		}
+
+		if msg.Type != speakerbob.PlaybackCommandType {
+			continue
+		}
+
+		var report map[string]string
+		_ = json.Unmarshal(msg.Body, &report)
+		assert.Equal(t, "p1", report["play_id"])
+
+		statuses = append(statuses, sound.PlaybackStatus(report["status"]))
+	}
+
+	assert.Equal(t, []sound.PlaybackStatus{sound.StartedPlaybackStatus, sound.FinishedPlaybackStatus}, statuses)
+
+	data, err := ioutil.ReadFile(output)
+	assert.NoError(t, err)
+	assert.Equal(t, "audio-s1", string(data))
+
+	// audio is cached
+	f, err := a.Cache.Open(ctx, "s1", func(context.Context, string, io.Writer) error {
+		t.Fatal("cached audio downloaded")
+		return nil
+	})
+	assert.NoError(t, err)
+	_ = f.Close()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&downloads))
+}
+
+func TestClockOffset(t *testing.T) {
+	// our clock is 100ms ahead with a 20ms round trip
+	body := json.RawMessage(`{"client_time": 1100, "server_receive": 1010, "server_transmit": 1010}`)
+
+	assert.Equal(t, int64(100), clockOffset(body, time.Unix(0, 1120*int64(time.Millisecond))))
+}
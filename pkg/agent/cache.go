@@ -0,0 +1,64 @@
+package agent
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Cache stores downloaded audio on disk by sound id. The audio for a sound never changes so entries are never
+// invalidated.
+type Cache struct {
+	Path string
+
+	m sync.Mutex
+}
+
+// DownloadFunc writes the audio for a sound to w.
+type DownloadFunc func(ctx context.Context, soundId string, w io.Writer) error
+
+// Open returns the cached audio for a sound, downloading it if it is not cached.
+func (c *Cache) Open(ctx context.Context, soundId string, download DownloadFunc) (*os.File, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	path := c.path(soundId)
+
+	f, err := os.Open(path)
+	if err == nil || !os.IsNotExist(err) {
+		return f, err
+	}
+
+	if err = os.MkdirAll(c.Path, 0755); err != nil {
+		return nil, err
+	}
+
+	// download to a temporary file so a failed download is never cached
+	tmp, err := ioutil.TempFile(c.Path, soundId+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if err = download(ctx, soundId, tmp); err != nil {
+		_ = tmp.Close()
+		return nil, err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+
+	return os.Open(path)
+}
+
+func (c *Cache) path(soundId string) string {
+	return filepath.Join(c.Path, filepath.Base(soundId)+".mp3")
+}
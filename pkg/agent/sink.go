@@ -0,0 +1,51 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// Sink plays audio.
+type Sink interface {
+	// Play blocks until the audio finished playing.
+	Play(ctx context.Context, audio io.Reader) error
+}
+
+// CommandSink plays audio by writing it to the stdin of a command, like ffplay or aplay.
+type CommandSink struct {
+	Command []string
+}
+
+func (s CommandSink) Play(ctx context.Context, audio io.Reader) error {
+	if len(s.Command) == 0 {
+		return errors.New("no sink command configured")
+	}
+
+	cmd := exec.CommandContext(ctx, s.Command[0], s.Command[1:]...)
+	cmd.Stdin = audio
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+// FileSink appends audio to a file, the file may be a named pipe read by another process.
+type FileSink struct {
+	Path string
+}
+
+func (s FileSink) Play(_ context.Context, audio io.Reader) error {
+	f, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(f, audio); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
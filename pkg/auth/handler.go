@@ -8,7 +8,7 @@ type Handler struct {
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if _, ok := h.AuthService.VerifyRequest(r); !ok {
+	if _, ok := h.AuthService.VerifyRequest(r); !ok && !h.AuthService.GuestAllowed(requiredPermission(r)) {
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
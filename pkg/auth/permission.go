@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+)
+
+type Permission string
+
+const (
+	ListenPermission Permission = "listen"
+	PlayPermission   Permission = "play"
+	SayPermission    Permission = "say"
+	UploadPermission Permission = "upload"
+	EditPermission   Permission = "edit"
+	DeletePermission Permission = "delete"
+)
+
+// requiredPermission returns the permission an unauthenticated request needs to be served.
+func requiredPermission(r *http.Request) Permission {
+	path := strings.TrimSuffix(r.URL.Path, "/")
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		// bulk reads of the whole soundboard or the server's metrics are not listening
+		if strings.HasSuffix(path, "/sound/export") || strings.HasSuffix(path, "/debug/vars") {
+			return EditPermission
+		}
+
+		return ListenPermission
+	case http.MethodPut:
+		if strings.HasSuffix(path, "/say") {
+			return SayPermission
+		}
+
+		if strings.HasSuffix(path, "/play") {
+			return PlayPermission
+		}
+	case http.MethodPost:
+		if strings.HasSuffix(path, "/sound/sounds") {
+			return UploadPermission
+		}
+	case http.MethodDelete:
+		return DeletePermission
+	}
+
+	return EditPermission
+}
@@ -0,0 +1,68 @@
+package auth
+
+// Role grants a user access beyond what every user has.
+type Role string
+
+const (
+	// AdminRole may use the admin api.
+	AdminRole Role = "admin"
+)
+
+var Roles = []Role{AdminRole}
+
+// RoleBinding holds the roles granted to a user, the id is the user's id.
+//
+//go:generate go run github.com/paynejacob/hotcereal providergen github.com/paynejacob/speakerbob/pkg/auth.RoleBinding
+type RoleBinding struct {
+	Id    string `json:"id" hotcereal:"key"`
+	Roles []Role `json:"roles"`
+}
+
+// Has reports whether the binding grants role.
+func (b *RoleBinding) Has(role Role) bool {
+	if b == nil {
+		return false
+	}
+
+	for i := range b.Roles {
+		if b.Roles[i] == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Grant adds role to the binding, it returns false if the role was already granted.
+func (b *RoleBinding) Grant(role Role) bool {
+	if b.Has(role) {
+		return false
+	}
+
+	b.Roles = append(b.Roles, role)
+
+	return true
+}
+
+// Revoke removes role from the binding, it returns false if the role was not granted.
+func (b *RoleBinding) Revoke(role Role) bool {
+	for i := range b.Roles {
+		if b.Roles[i] == role {
+			b.Roles = append(b.Roles[:i], b.Roles[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidRole reports whether role is a known role.
+func ValidRole(role Role) bool {
+	for i := range Roles {
+		if Roles[i] == role {
+			return true
+		}
+	}
+
+	return false
+}
@@ -21,11 +21,15 @@ const (
 )
 
 type Service struct {
-	TokenProvider *TokenProvider
-	UserProvider  *UserProvider
-	states        StateManager
+	TokenProvider       *TokenProvider
+	UserProvider        *UserProvider
+	RoleBindingProvider *RoleBindingProvider
+	states              StateManager
 
 	Providers []Provider
+
+	// GuestPermissions are granted to requests that are not authenticated.
+	GuestPermissions []Permission
 }
 
 type createTokenResponse struct {
@@ -102,6 +106,42 @@ func (s *Service) Enabled() bool {
 	return len(s.Providers) > 0
 }
 
+// GuestAllowed reports whether unauthenticated requests are granted the given permission.
+func (s *Service) GuestAllowed(permission Permission) bool {
+	if !s.Enabled() {
+		return true
+	}
+
+	for i := range s.GuestPermissions {
+		if s.GuestPermissions[i] == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasRole reports whether the user was granted role.
+func (s *Service) HasRole(userId string, role Role) bool {
+	if s.RoleBindingProvider == nil {
+		return false
+	}
+
+	return s.RoleBindingProvider.Get(userId).Has(role)
+}
+
+// RoleAllowed reports whether the request was made by a user with role, every request is allowed when
+// authentication is disabled.
+func (s *Service) RoleAllowed(r *http.Request, role Role) bool {
+	if !s.Enabled() {
+		return true
+	}
+
+	token, valid := s.VerifyRequest(r)
+
+	return valid && s.HasRole(token.UserId, role)
+}
+
 func (s *Service) VerifyRequest(r *http.Request) (*Token, bool) {
 	return s.verifyRequest(r, Bearer, Session)
 }
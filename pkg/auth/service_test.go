@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"github.com/paynejacob/hotcereal/pkg/stores/memory"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testProvider struct{}
+
+func (testProvider) Name() string { return "test" }
+
+func (testProvider) VerifyCallback(*http.Request) (Principal, string, error) {
+	return "", "", AccessDenied{}
+}
+
+func (testProvider) LoginRedirect(http.ResponseWriter, *http.Request, string) {}
+
+func TestRequiredPermission(t *testing.T) {
+	for _, tc := range []struct {
+		method     string
+		path       string
+		permission Permission
+	}{
+		{http.MethodGet, "/sound/sounds/", ListenPermission},
+		{http.MethodHead, "/sound/sounds/abc/download/", ListenPermission},
+		{http.MethodGet, "/sound/export/", EditPermission},
+		{http.MethodGet, "/debug/vars/", EditPermission},
+		{http.MethodPut, "/sound/sounds/abc/play/", PlayPermission},
+		{http.MethodPut, "/sound/groups/abc/play/", PlayPermission},
+		{http.MethodPut, "/sound/say/", SayPermission},
+		{http.MethodPost, "/sound/sounds/", UploadPermission},
+		{http.MethodPost, "/sound/groups/", EditPermission},
+		{http.MethodPatch, "/sound/sounds/abc/", EditPermission},
+		{http.MethodDelete, "/sound/sounds/abc/", DeletePermission},
+	} {
+		r := httptest.NewRequest(tc.method, tc.path, nil)
+		assert.Equal(t, tc.permission, requiredPermission(r), "%s %s", tc.method, tc.path)
+	}
+}
+
+func TestGuestPermissions(t *testing.T) {
+	tokenProvider := &TokenProvider{Store: memory.New()}
+	assert.NoError(t, tokenProvider.Initialize())
+
+	token := NewToken()
+	token.Type = Bearer
+	assert.NoError(t, tokenProvider.Save(&token))
+
+	svc := &Service{
+		TokenProvider:    tokenProvider,
+		Providers:        []Provider{testProvider{}},
+		GuestPermissions: []Permission{ListenPermission, PlayPermission},
+	}
+
+	handler := svc.Handler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(method string, path string, bearer string) int {
+		r := httptest.NewRequest(method, path, nil)
+		if bearer != "" {
+			r.Header.Set(authorizationHeader, authorizationHeaderValuePrefix+bearer)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		return w.Code
+	}
+
+	// guests
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/sound/sounds/", ""))
+	assert.Equal(t, http.StatusOK, serve(http.MethodPut, "/sound/sounds/abc/play/", ""))
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodPut, "/sound/say/", ""))
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodPost, "/sound/sounds/", ""))
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodDelete, "/sound/sounds/abc/", ""))
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, "/sound/export/", ""))
+
+	// authenticated
+	assert.Equal(t, http.StatusOK, serve(http.MethodPut, "/sound/say/", token.Token))
+	assert.Equal(t, http.StatusOK, serve(http.MethodDelete, "/sound/sounds/abc/", token.Token))
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodDelete, "/sound/sounds/abc/", "invalid"))
+
+	// guests are allowed everything without auth providers
+	svc.Providers = nil
+	assert.True(t, svc.GuestAllowed(DeletePermission))
+}
@@ -6,6 +6,9 @@ import (
 	"time"
 )
 
+// preference users set their display name with
+const namePreference = "name"
+
 type Principal string
 
 func NewPrincipal(providerName, userId string) Principal {
@@ -30,3 +33,8 @@ func NewUser() User {
 		Preferences: make(map[string]string, 0),
 	}
 }
+
+// Name returns the display name the user chose, empty if they have not set one.
+func (u *User) Name() string {
+	return u.Preferences[namePreference]
+}
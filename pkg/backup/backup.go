@@ -0,0 +1,361 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/paynejacob/speakerbob/pkg/blob"
+	"github.com/paynejacob/speakerbob/pkg/store/badgerdb"
+	"github.com/paynejacob/speakerbob/pkg/version"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// FormatVersion is incremented when the archive layout changes, archives with a newer format can not be restored.
+	FormatVersion = 2
+
+	manifestName = "manifest.json"
+	dataName     = "data.badger"
+	blobsDir     = "blobs/"
+
+	// writes badger may have pending while loading a backup
+	maxPendingWrites = 256
+)
+
+var ErrChecksum = errors.New("backup checksum does not match, the archive is corrupt")
+
+// Manifest describes an archive, it is the first file in the archive.
+type Manifest struct {
+	FormatVersion int       `json:"format_version"`
+	Version       string    `json:"version"`
+	CreatedAt     time.Time `json:"created_at"`
+	Size          int64     `json:"size"`
+	SHA256        string    `json:"sha256"`
+
+	// Blobs is the number of blobs after the data, they are named after the sha256 of their content.
+	Blobs int `json:"blobs"`
+}
+
+// Write writes an archive of every key in db and every blob they reference to w. The database can be in use while it
+// is backed up, blobs are listed after the keys are written so a sound deleted during the backup may be restored
+// without audio.
+func Write(w io.Writer, db *badger.DB, blobs blob.Store) (manifest Manifest, err error) {
+	// the manifest is written before the data so the data is staged to know its size and checksum
+	data, err := ioutil.TempFile("", "speakerbob-backup-*")
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = data.Close()
+		_ = os.Remove(data.Name())
+	}()
+
+	hash := sha256.New()
+
+	if _, err = db.Backup(io.MultiWriter(data, hash), 0); err != nil {
+		return
+	}
+
+	hashes, err := refs(db)
+	if err != nil {
+		return
+	}
+
+	manifest = Manifest{
+		FormatVersion: FormatVersion,
+		Version:       version.Version,
+		CreatedAt:     time.Now(),
+		SHA256:        hex.EncodeToString(hash.Sum(nil)),
+		Blobs:         len(hashes),
+	}
+
+	if manifest.Size, err = data.Seek(0, io.SeekCurrent); err != nil {
+		return
+	}
+
+	if _, err = data.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+
+	body, err := json.Marshal(manifest)
+	if err != nil {
+		return
+	}
+
+	tw := tar.NewWriter(w)
+
+	if err = writeFile(tw, manifestName, int64(len(body)), manifest.CreatedAt, bytes.NewReader(body)); err != nil {
+		return
+	}
+
+	if err = writeFile(tw, dataName, manifest.Size, manifest.CreatedAt, data); err != nil {
+		return
+	}
+
+	for _, h := range hashes {
+		if err = writeBlob(tw, blobs, h, manifest.CreatedAt); err != nil {
+			return
+		}
+	}
+
+	err = tw.Close()
+
+	return
+}
+
+// Verify reads an archive, checks its integrity and that it can be loaded. The number of keys in the archive is
+// returned.
+func Verify(r io.Reader) (Manifest, int, error) {
+	var keys int
+
+	manifest, data, tr, err := read(r)
+	if data != nil {
+		defer func() {
+			_ = data.Close()
+			_ = os.Remove(data.Name())
+		}()
+	}
+	if err != nil {
+		return manifest, 0, err
+	}
+
+	err = readBlobs(tr, manifest, func(string, io.Reader, int64) error { return nil })
+	if err != nil {
+		return manifest, 0, err
+	}
+
+	if _, err = data.Seek(0, io.SeekStart); err != nil {
+		return manifest, 0, err
+	}
+
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		return manifest, 0, err
+	}
+	defer db.Close()
+
+	if err = db.Load(data, maxPendingWrites); err != nil {
+		return manifest, 0, fmt.Errorf("unable to load backup: %w", err)
+	}
+
+	err = db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			keys++
+		}
+
+		return nil
+	})
+
+	return manifest, keys, err
+}
+
+// Restore verifies an archive, writes its blobs to blobs and loads its keys into db. Keys in db and blobs that are
+// not in the archive are kept.
+func Restore(r io.Reader, db *badger.DB, blobs blob.Store) (Manifest, error) {
+	manifest, data, tr, err := read(r)
+	if data != nil {
+		defer func() {
+			_ = data.Close()
+			_ = os.Remove(data.Name())
+		}()
+	}
+	if err != nil {
+		return manifest, err
+	}
+
+	// keys are loaded last so they never reference a blob that was not restored
+	err = readBlobs(tr, manifest, func(hash string, r io.Reader, size int64) error {
+		return blobs.Put(hash, r, size)
+	})
+	if err != nil {
+		return manifest, err
+	}
+
+	if _, err = data.Seek(0, io.SeekStart); err != nil {
+		return manifest, err
+	}
+
+	return manifest, db.Load(data, maxPendingWrites)
+}
+
+// read stages the archive's data in a temporary file and verifies it against the manifest. The blobs are left in
+// the returned reader.
+func read(r io.Reader) (manifest Manifest, data *os.File, tr *tar.Reader, err error) {
+	var header *tar.Header
+
+	tr = tar.NewReader(r)
+
+	if header, err = tr.Next(); err != nil {
+		return manifest, nil, nil, fmt.Errorf("unable to read backup: %w", err)
+	}
+
+	if header.Name != manifestName {
+		return manifest, nil, nil, errors.New("not a speakerbob backup, the archive has no manifest")
+	}
+
+	if err = json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return manifest, nil, nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+
+	if manifest.FormatVersion > FormatVersion {
+		return manifest, nil, nil, fmt.Errorf("the backup format %d is newer than this version of speakerbob supports", manifest.FormatVersion)
+	}
+
+	if header, err = tr.Next(); err != nil {
+		return manifest, nil, nil, fmt.Errorf("unable to read backup data: %w", err)
+	}
+
+	if header.Name != dataName {
+		return manifest, nil, nil, fmt.Errorf("unexpected file in backup: %s", header.Name)
+	}
+
+	if data, err = ioutil.TempFile("", "speakerbob-restore-*"); err != nil {
+		return manifest, nil, nil, err
+	}
+
+	hash := sha256.New()
+
+	size, err := io.Copy(io.MultiWriter(data, hash), tr)
+	if err != nil {
+		return manifest, data, nil, err
+	}
+
+	if size != manifest.Size || hex.EncodeToString(hash.Sum(nil)) != manifest.SHA256 {
+		return manifest, data, nil, ErrChecksum
+	}
+
+	return manifest, data, tr, nil
+}
+
+// readBlobs verifies the blobs after an archive's data and calls process with each of them, blobs are staged so
+// process only sees content that matches its hash.
+func readBlobs(tr *tar.Reader, manifest Manifest, process func(hash string, r io.Reader, size int64) error) error {
+	var blobs int
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("unable to read backup blobs: %w", err)
+		}
+
+		if !strings.HasPrefix(header.Name, blobsDir) {
+			return fmt.Errorf("unexpected file in backup: %s", header.Name)
+		}
+
+		if err = readBlob(tr, path.Base(header.Name), process); err != nil {
+			return err
+		}
+
+		blobs++
+	}
+
+	if blobs != manifest.Blobs {
+		return ErrChecksum
+	}
+
+	return nil
+}
+
+func readBlob(r io.Reader, hash string, process func(hash string, r io.Reader, size int64) error) error {
+	tmp, err := ioutil.TempFile("", "speakerbob-restore-blob-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	sum := sha256.New()
+
+	size, err := io.Copy(io.MultiWriter(tmp, sum), r)
+	if err != nil {
+		return err
+	}
+
+	if hex.EncodeToString(sum.Sum(nil)) != hash {
+		return ErrChecksum
+	}
+
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	return process(hash, tmp, size)
+}
+
+// refs returns the blobs referenced by the keys in db, sorted and without duplicates.
+func refs(db *badger.DB) ([]string, error) {
+	seen := map[string]bool{}
+
+	err := blob.Refs(badgerdb.Store{DB: db}, func(hash string) error {
+		seen[hash] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, 0, len(seen))
+	for hash := range seen {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+
+	return hashes, nil
+}
+
+func writeBlob(tw *tar.Writer, blobs blob.Store, hash string, modTime time.Time) error {
+	r, err := blobs.Open(hash)
+	if err != nil {
+		return fmt.Errorf("unable to read blob %s: %w", hash, err)
+	}
+	defer r.Close()
+
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	return writeFile(tw, blobsDir+hash, size, modTime, r)
+}
+
+func writeFile(tw *tar.Writer, name string, size int64, modTime time.Time, r io.Reader) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    size,
+		ModTime: modTime,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tw, r)
+
+	return err
+}
@@ -0,0 +1,94 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/paynejacob/hotcereal/pkg/store"
+	"github.com/paynejacob/speakerbob/pkg/blob"
+	"github.com/paynejacob/speakerbob/pkg/store/badgerdb"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func newDB(t *testing.T) *badger.DB {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	return db
+}
+
+func TestBackup(t *testing.T) {
+	var buf bytes.Buffer
+
+	src := newDB(t)
+	assert.NoError(t, src.Update(func(txn *badger.Txn) error {
+		_ = txn.Set([]byte("foo"), []byte("bar"))
+		return txn.Set([]byte("fizz"), []byte("buzz"))
+	}))
+
+	srcBlobs := blob.FileStore{Path: t.TempDir()}
+	assert.NoError(t, blob.NewLazyStore(badgerdb.Store{DB: src}, srcBlobs).WriteLazy(fieldKey("a"), strings.NewReader("audio")))
+
+	manifest, err := Write(&buf, src, srcBlobs)
+	assert.NoError(t, err)
+	assert.Equal(t, FormatVersion, manifest.FormatVersion)
+	assert.Equal(t, 1, manifest.Blobs)
+
+	// verify
+	verified, keys, err := Verify(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, keys)
+	assert.Equal(t, manifest.SHA256, verified.SHA256)
+
+	// restore
+	dst := newDB(t)
+	dstBlobs := blob.FileStore{Path: t.TempDir()}
+	_, err = Restore(bytes.NewReader(buf.Bytes()), dst, dstBlobs)
+	assert.NoError(t, err)
+
+	var audio bytes.Buffer
+	assert.NoError(t, blob.NewLazyStore(badgerdb.Store{DB: dst}, dstBlobs).ReadLazy(fieldKey("a"), &audio))
+	assert.Equal(t, "audio", audio.String())
+	assert.NoError(t, dst.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte("foo"))
+		if err != nil {
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			assert.Equal(t, "bar", string(val))
+			return nil
+		})
+	}))
+
+	// truncated
+	_, _, err = Verify(bytes.NewReader(buf.Bytes()[:buf.Len()/2]))
+	assert.Error(t, err)
+
+	// not a backup
+	var other bytes.Buffer
+	tw := tar.NewWriter(&other)
+	assert.NoError(t, writeFile(tw, "foo.txt", 3, manifest.CreatedAt, bytes.NewReader([]byte("foo"))))
+	assert.NoError(t, tw.Close())
+
+	_, _, err = Verify(&other)
+	assert.Error(t, err)
+}
+
+func fieldKey(id string) store.FieldKey {
+	k := store.FieldKey{
+		ObjectKey: store.ObjectKey{
+			TypeKey:  store.TypeKey{Body: "testTest", PackageLength: 4, TypeLength: 4},
+			IdLength: len(id),
+		},
+		FieldLength: len("Audio"),
+	}
+
+	k.Body += id + "Audio"
+	return k
+}
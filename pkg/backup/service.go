@@ -0,0 +1,75 @@
+package backup
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/gorilla/mux"
+	"github.com/paynejacob/speakerbob/pkg/auth"
+	"github.com/paynejacob/speakerbob/pkg/blob"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"time"
+)
+
+// Service serves backups of the running server to admins.
+type Service struct {
+	DB          *badger.DB
+	Blobs       blob.Store
+	AuthService *auth.Service
+}
+
+func (s Service) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/admin/backup/", s.backup).Methods(http.MethodGet)
+}
+
+func (s Service) Run(context.Context) {}
+
+func (s Service) backup(w http.ResponseWriter, r *http.Request) {
+	if !s.AuthService.RoleAllowed(r, auth.AdminRole) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	filename := fmt.Sprintf("speakerbob-%s.tar", time.Now().Format("20060102-150405"))
+
+	// backups can take longer than the http server's write timeout, hijack the connection when possible
+	if hijacker, ok := w.(http.Hijacker); ok {
+		conn, buf, err := hijacker.Hijack()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer conn.Close()
+
+		_ = conn.SetDeadline(time.Time{})
+		_, _ = buf.WriteString("HTTP/1.1 200 OK\r\n" +
+			"Content-Type: application/x-tar\r\n" +
+			"Content-Disposition: attachment; filename=\"" + filename + "\"\r\n" +
+			"Connection: close\r\n\r\n")
+
+		s.write(buf.Writer)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+filename+"\"")
+
+	s.write(bufio.NewWriter(w))
+}
+
+func (s Service) write(w *bufio.Writer) {
+	manifest, err := Write(w, s.DB, s.Blobs)
+	if err == nil {
+		err = w.Flush()
+	}
+
+	if err != nil {
+		// the response has started, the client sees a truncated archive that fails verification
+		logrus.Errorf("[backup.backup] failed to write backup: %v", err)
+		return
+	}
+
+	logrus.Infof("[backup.backup] wrote backup of %d bytes", manifest.Size)
+}
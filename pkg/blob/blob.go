@@ -0,0 +1,28 @@
+package blob
+
+import (
+	"io"
+)
+
+// Driver selects where blobs are stored.
+type Driver string
+
+const (
+	FilesystemDriver Driver = "filesystem"
+	S3Driver         Driver = "s3"
+)
+
+// Drivers are the supported drivers, the first is the default.
+var Drivers = []Driver{FilesystemDriver, S3Driver}
+
+// Store stores immutable blobs. Keys are the sha256 of the content so identical content is stored once.
+type Store interface {
+	// Put writes size bytes from r, writing a key that exists replaces it.
+	Put(key string, r io.Reader, size int64) error
+
+	// Open opens a blob for reading, storage.ErrNotFound is returned if it does not exist.
+	Open(key string) (io.ReadSeekCloser, error)
+
+	// Delete deletes a blob, deleting a key that does not exist is not an error.
+	Delete(key string) error
+}
@@ -0,0 +1,184 @@
+package blob
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+)
+
+// Encrypted blobs start with a header naming the key they were encrypted with and the iv, the content is encrypted
+// with AES in counter mode like badger encrypts its data so blobs can still be read from any offset.
+const (
+	encryptedMagic = "sbblob\x00\x01"
+	keyIdSize      = 8
+	headerSize     = len(encryptedMagic) + keyIdSize + aes.BlockSize
+)
+
+var (
+	ErrEncrypted = errors.New("the blob is encrypted, configure the encryption key")
+	ErrWrongKey  = errors.New("the blob is encrypted with another key")
+)
+
+// header is the header of an encrypted blob.
+type header struct {
+	keyId []byte
+	iv    []byte
+}
+
+// keyId identifies a key without revealing it.
+func keyId(key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte("speakerbob blob key"))
+
+	return mac.Sum(nil)[:keyIdSize]
+}
+
+// encrypt writes the header of a new encrypted blob to w and returns a writer that encrypts the content.
+func encrypt(w io.Writer, key []byte) (io.Writer, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	if _, err = rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	if _, err = io.WriteString(w, encryptedMagic); err != nil {
+		return nil, err
+	}
+
+	if _, err = w.Write(append(keyId(key), iv...)); err != nil {
+		return nil, err
+	}
+
+	return cipher.StreamWriter{S: cipher.NewCTR(block, iv), W: w}, nil
+}
+
+// readHeader reads the header of file, ok is false if the blob is not encrypted. The file is left at the start of
+// the content.
+func readHeader(file *os.File) (h header, ok bool, err error) {
+	buf := make([]byte, headerSize)
+
+	_, err = io.ReadFull(file, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return h, false, err
+	}
+
+	// blobs written without a key are stored as they are
+	if err != nil || !bytes.HasPrefix(buf, []byte(encryptedMagic)) {
+		_, err = file.Seek(0, io.SeekStart)
+		return h, false, err
+	}
+
+	buf = buf[len(encryptedMagic):]
+
+	return header{keyId: buf[:keyIdSize], iv: buf[keyIdSize:]}, true, nil
+}
+
+// decrypt returns a reader of the content of file, file is closed if it can not be read.
+func decrypt(file *os.File, key []byte) (io.ReadSeekCloser, error) {
+	h, ok, err := readHeader(file)
+	if err != nil || !ok {
+		if err != nil {
+			_ = file.Close()
+		}
+
+		return file, err
+	}
+
+	if len(key) == 0 {
+		_ = file.Close()
+		return nil, ErrEncrypted
+	}
+
+	if !hmac.Equal(h.keyId, keyId(key)) {
+		_ = file.Close()
+		return nil, ErrWrongKey
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return &decryptingFile{file: file, block: block, iv: h.iv, stream: cipher.NewCTR(block, h.iv)}, nil
+}
+
+// decryptingFile decrypts an encrypted blob, offsets are offsets in the content.
+type decryptingFile struct {
+	file   *os.File
+	block  cipher.Block
+	iv     []byte
+	stream cipher.Stream
+	offset int64
+}
+
+func (d *decryptingFile) Read(p []byte) (int, error) {
+	n, err := d.file.Read(p)
+	d.stream.XORKeyStream(p[:n], p[:n])
+	d.offset += int64(n)
+
+	return n, err
+}
+
+func (d *decryptingFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += d.offset
+	case io.SeekEnd:
+		info, err := d.file.Stat()
+		if err != nil {
+			return 0, err
+		}
+
+		offset += info.Size() - int64(headerSize)
+	}
+
+	if offset < 0 {
+		return 0, errors.New("blob: negative position")
+	}
+
+	if _, err := d.file.Seek(int64(headerSize)+offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	d.stream = streamAt(d.block, d.iv, offset)
+	d.offset = offset
+
+	return offset, nil
+}
+
+func (d *decryptingFile) Close() error {
+	return d.file.Close()
+}
+
+// streamAt returns the key stream of iv from offset, the counter of each block is the iv plus the block's index.
+func streamAt(block cipher.Block, iv []byte, offset int64) cipher.Stream {
+	counter := make([]byte, len(iv))
+	copy(counter, iv)
+
+	// add the index of the block holding offset to the big endian counter
+	n := uint64(offset / aes.BlockSize)
+	for i := len(counter) - 1; i >= 0 && n > 0; i-- {
+		sum := uint64(counter[i]) + n&0xff
+		counter[i] = byte(sum)
+		n = n>>8 + sum>>8
+	}
+
+	stream := cipher.NewCTR(block, counter)
+
+	// skip to offset inside the block
+	skip := make([]byte, offset%aes.BlockSize)
+	stream.XORKeyStream(skip, skip)
+
+	return stream
+}
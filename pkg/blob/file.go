@@ -0,0 +1,154 @@
+package blob
+
+import (
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"github.com/paynejacob/speakerbob/pkg/storage"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileStore stores blobs as files in a directory. Blobs are encrypted with Key if it is set, blobs written before a
+// key was set are read as they are until the key is rotated.
+type FileStore struct {
+	Path string
+	Key  []byte
+}
+
+func (f FileStore) Put(key string, r io.Reader, size int64) error {
+	path, err := f.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	// write to a temporary file so readers never see a partial blob
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	var w io.Writer = tmp
+	if len(f.Key) > 0 {
+		if w, err = encrypt(tmp, f.Key); err != nil {
+			_ = tmp.Close()
+			return err
+		}
+	}
+
+	n, err := io.Copy(w, r)
+	if err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	if n != size {
+		return fmt.Errorf("blob %s is %d bytes, expected %d", key, n, size)
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (f FileStore) Open(key string) (io.ReadSeekCloser, error) {
+	path, err := f.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, storage.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return decrypt(file, f.Key)
+}
+
+func (f FileStore) Delete(key string) error {
+	path, err := f.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err = os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// RotateKey encrypts every blob with newKey, blobs are read with the store's key. Blobs already encrypted with newKey
+// are skipped so an interrupted rotation can be run again.
+func (f FileStore) RotateKey(newKey []byte) error {
+	dst := FileStore{Path: f.Path, Key: newKey}
+
+	return filepath.Walk(f.Path, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || strings.HasPrefix(info.Name(), ".tmp-") {
+			return err
+		}
+
+		done, err := encryptedWith(path, newKey)
+		if err != nil || done {
+			return err
+		}
+
+		r, err := f.Open(info.Name())
+		if err != nil {
+			return fmt.Errorf("unable to read blob %s: %w", info.Name(), err)
+		}
+		defer r.Close()
+
+		size, err := r.Seek(0, io.SeekEnd)
+		if err != nil {
+			return err
+		}
+
+		if _, err = r.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		return dst.Put(info.Name(), r, size)
+	})
+}
+
+// encryptedWith returns true if the blob at path is encrypted with key, or is not encrypted and key is empty.
+func encryptedWith(path string, key []byte) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	h, ok, err := readHeader(file)
+	if err != nil {
+		return false, err
+	}
+
+	if !ok {
+		return len(key) == 0, nil
+	}
+
+	return len(key) > 0 && hmac.Equal(h.keyId, keyId(key)), nil
+}
+
+// path spreads blobs over directories named after the first 2 characters of the key.
+func (f FileStore) path(key string) (string, error) {
+	if len(key) < 3 || key != filepath.Base(key) {
+		return "", fmt.Errorf("invalid blob key: %s", key)
+	}
+
+	return filepath.Join(f.Path, key[:2], key), nil
+}
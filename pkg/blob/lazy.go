@@ -0,0 +1,234 @@
+package blob
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/paynejacob/hotcereal/pkg/store"
+	"github.com/paynejacob/speakerbob/pkg/storage"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// refType holds the blob each lazy field references.
+var refType = store.TypeKey{Body: "blobRef", PackageLength: 4, TypeLength: 3}
+
+// LazyStore stores lazy fields in a blob store, every other key is kept in the wrapped store. Lazy fields written
+// before blobs existed are read from the wrapped store until they are moved with MoveLazy.
+type LazyStore struct {
+	store.Store
+	Blobs Store
+
+	// serializes writes and deletes so a blob is never deleted while a new reference to it is written
+	mu sync.Mutex
+}
+
+func NewLazyStore(s store.Store, blobs Store) *LazyStore {
+	return &LazyStore{Store: s, Blobs: blobs}
+}
+
+// Unwrap returns the store holding everything but lazy fields.
+func (s *LazyStore) Unwrap() store.Store {
+	return s.Store
+}
+
+func (s *LazyStore) ReadLazy(key store.FieldKey, w io.Writer) error {
+	r, err := s.OpenLazy(key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	_, err = io.Copy(w, r)
+
+	return err
+}
+
+// OpenLazy opens a lazy field for reading, the field can be read from any offset.
+func (s *LazyStore) OpenLazy(key store.FieldKey) (io.ReadSeekCloser, error) {
+	hash, err := s.ref(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if hash == "" {
+		var buf bytes.Buffer
+
+		if err = s.Store.ReadLazy(key, &buf); err != nil {
+			return nil, err
+		}
+
+		return nopCloser{bytes.NewReader(buf.Bytes())}, nil
+	}
+
+	return s.Blobs.Open(hash)
+}
+
+func (s *LazyStore) WriteLazy(key store.FieldKey, r io.Reader) error {
+	// the content is staged to know its hash before it is stored
+	tmp, err := ioutil.TempFile("", "speakerbob-blob-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	hash := sha256.New()
+
+	size, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if err != nil {
+		return err
+	}
+
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, err := s.ref(key)
+	if err != nil {
+		return err
+	}
+
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	if err = s.Blobs.Put(sum, tmp, size); err != nil {
+		return err
+	}
+
+	if err = s.Store.Save(refKey(key), []byte(sum)); err != nil {
+		return err
+	}
+
+	// the field may have been written before blobs existed
+	if err = s.Store.Delete(key); err != nil {
+		return err
+	}
+
+	if previous != "" && previous != sum {
+		return s.release(previous)
+	}
+
+	return nil
+}
+
+func (s *LazyStore) Delete(keys ...store.Key) error {
+	var hashes []string
+	var refs []store.Key
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range keys {
+		fieldKey, ok := keys[i].(store.FieldKey)
+		if !ok {
+			continue
+		}
+
+		hash, err := s.ref(fieldKey)
+		if err != nil {
+			return err
+		}
+
+		if hash != "" {
+			hashes = append(hashes, hash)
+			refs = append(refs, refKey(fieldKey))
+		}
+	}
+
+	if err := s.Store.Delete(append(keys, refs...)...); err != nil {
+		return err
+	}
+
+	for i := range hashes {
+		if err := s.release(hashes[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MoveLazy moves a lazy field written before blobs existed to the blob store, moved is false if there was nothing
+// to move.
+func (s *LazyStore) MoveLazy(key store.FieldKey) (moved bool, err error) {
+	var buf bytes.Buffer
+
+	hash, err := s.ref(key)
+	if err != nil || hash != "" {
+		return false, err
+	}
+
+	err = s.Store.ReadLazy(key, &buf)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, s.WriteLazy(key, &buf)
+}
+
+// ref returns the hash of the blob a field references, or an empty string if it does not reference one.
+func (s *LazyStore) ref(key store.FieldKey) (string, error) {
+	value, err := s.Store.Get(refKey(key))
+	if errors.Is(err, storage.ErrNotFound) {
+		return "", nil
+	}
+
+	return string(value), err
+}
+
+// release deletes a blob if no field references it, blobs are shared by fields with the same content.
+func (s *LazyStore) release(hash string) error {
+	var referenced bool
+
+	err := s.Store.List(refType, func(value []byte) error {
+		if string(value) == hash {
+			referenced = true
+		}
+
+		return nil
+	})
+	if err != nil || referenced {
+		return err
+	}
+
+	return s.Blobs.Delete(hash)
+}
+
+// Refs calls process with the hash of the blob each lazy field of s references, blobs shared by fields are listed
+// once per field.
+func Refs(s store.Store, process func(hash string) error) error {
+	return s.List(refType, func(value []byte) error {
+		return process(string(value))
+	})
+}
+
+func refKey(key store.FieldKey) store.ObjectKey {
+	id := string(key.Bytes())
+
+	k := store.ObjectKey{
+		TypeKey:  refType,
+		IdLength: len(id),
+	}
+
+	k.Body += id
+	return k
+}
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,233 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/paynejacob/speakerbob/pkg/auth"
+	"github.com/paynejacob/speakerbob/pkg/sound"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+)
+
+// Client calls the speakerbob api.
+type Client struct {
+	// Server is the base url of the speakerbob server.
+	Server *url.URL
+	Token  string
+
+	HTTPClient *http.Client
+}
+
+// Error is returned when the server responds with an unexpected status.
+type Error struct {
+	StatusCode int
+	Message    string `json:"message"`
+}
+
+func (e Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("unexpected status: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+
+	return e.Message
+}
+
+// CreateTokenResponse is a new api token, the access token is only returned when the token is created.
+type CreateTokenResponse struct {
+	auth.Token
+	AccessToken string `json:"token"`
+}
+
+func New(server *url.URL, token string) *Client {
+	return &Client{Server: server, Token: token}
+}
+
+func (c *Client) ListSounds(ctx context.Context) (sounds []sound.Sound, err error) {
+	err = c.do(ctx, http.MethodGet, "/api/sound/sounds/", nil, "", &sounds)
+
+	return
+}
+
+// UploadSound creates a sound from an audio file, the sound is hidden until it is named.
+func (c *Client) UploadSound(ctx context.Context, filename string, audio io.Reader) (*sound.Sound, error) {
+	var s sound.Sound
+	var body bytes.Buffer
+
+	writer := multipart.NewWriter(&body)
+
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = io.Copy(part, audio); err != nil {
+		return nil, err
+	}
+
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+
+	err = c.do(ctx, http.MethodPost, "/api/sound/sounds/", &body, writer.FormDataContentType(), &s)
+
+	return &s, err
+}
+
+func (c *Client) RenameSound(ctx context.Context, soundId string, name string) error {
+	return c.doJSON(ctx, http.MethodPatch, "/api/sound/sounds/"+url.PathEscape(soundId)+"/", sound.Sound{Name: name}, nil)
+}
+
+func (c *Client) DeleteSound(ctx context.Context, soundId string) error {
+	return c.do(ctx, http.MethodDelete, "/api/sound/sounds/"+url.PathEscape(soundId)+"/", nil, "", nil)
+}
+
+func (c *Client) PlaySound(ctx context.Context, soundId string) error {
+	return c.do(ctx, http.MethodPut, "/api/sound/sounds/"+url.PathEscape(soundId)+"/play/", nil, "", nil)
+}
+
+// DownloadSound writes the audio for a sound to w.
+func (c *Client) DownloadSound(ctx context.Context, soundId string, w io.Writer) error {
+	resp, err := c.request(ctx, http.MethodGet, "/api/sound/sounds/"+url.PathEscape(soundId)+"/download/", nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(w, resp.Body)
+
+	return err
+}
+
+func (c *Client) CreateGroup(ctx context.Context, name string, soundIds []string) (*sound.Group, error) {
+	var group sound.Group
+
+	err := c.doJSON(ctx, http.MethodPost, "/api/sound/groups/", sound.Group{Name: name, SoundIds: soundIds}, &group)
+
+	return &group, err
+}
+
+func (c *Client) PlayGroup(ctx context.Context, groupId string) error {
+	return c.do(ctx, http.MethodPut, "/api/sound/groups/"+url.PathEscape(groupId)+"/play/", nil, "", nil)
+}
+
+// Say plays text as speech.
+func (c *Client) Say(ctx context.Context, text string) error {
+	return c.doJSON(ctx, http.MethodPut, "/api/sound/say/", text, nil)
+}
+
+// Queue returns the sounds waiting to be played.
+func (c *Client) Queue(ctx context.Context) (sounds []sound.Sound, err error) {
+	err = c.do(ctx, http.MethodGet, "/api/sound/queue/", nil, "", &sounds)
+
+	return
+}
+
+func (c *Client) CreateToken(ctx context.Context, name string) (*CreateTokenResponse, error) {
+	var token CreateTokenResponse
+
+	err := c.doJSON(ctx, http.MethodPost, "/auth/tokens/", auth.Token{Name: name}, &token)
+
+	return &token, err
+}
+
+// ExportSounds writes a zip of every sound and group to w.
+func (c *Client) ExportSounds(ctx context.Context, w io.Writer) error {
+	resp, err := c.request(ctx, http.MethodGet, "/api/sound/export/", nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(w, resp.Body)
+
+	return err
+}
+
+// ImportSounds creates the sounds and groups of an export that do not exist yet.
+func (c *Client) ImportSounds(ctx context.Context, r io.Reader) (*sound.ImportResult, error) {
+	var result sound.ImportResult
+
+	err := c.do(ctx, http.MethodPost, "/api/sound/import/", r, "application/zip", &result)
+
+	return &result, err
+}
+
+// Backup writes an archive of the server's data to w, the token must belong to an admin.
+func (c *Client) Backup(ctx context.Context, w io.Writer) error {
+	resp, err := c.request(ctx, http.MethodGet, "/api/admin/backup/", nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(w, resp.Body)
+
+	return err
+}
+
+func (c *Client) doJSON(ctx context.Context, method string, path string, body interface{}, v interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	return c.do(ctx, method, path, bytes.NewReader(data), "application/json", v)
+}
+
+// do sends the request and decodes the response into v, if v is nil the response is discarded.
+func (c *Client) do(ctx context.Context, method string, path string, body io.Reader, contentType string, v interface{}) error {
+	resp, err := c.request(ctx, method, path, body, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if v == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// request sends the request, responses with an error status are returned as an Error.
+func (c *Client) request(ctx context.Context, method string, path string, body io.Reader, contentType string) (*http.Response, error) {
+	u := *c.Server
+	u.Path = path
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		e := Error{StatusCode: resp.StatusCode}
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		_ = resp.Body.Close()
+
+		return nil, e
+	}
+
+	return resp, nil
+}
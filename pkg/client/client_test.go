@@ -0,0 +1,106 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/paynejacob/speakerbob/pkg/sound"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+)
+
+const testToken = "foobar"
+
+func newServer() *httptest.Server {
+	router := mux.NewRouter()
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer "+testToken {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	router.HandleFunc("/api/sound/sounds/", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]sound.Sound{{Id: "s1", Name: "foo"}})
+	}).Methods(http.MethodGet)
+	router.HandleFunc("/api/sound/sounds/", func(w http.ResponseWriter, r *http.Request) {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+		data, _ := ioutil.ReadAll(file)
+
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(sound.Sound{Id: header.Filename + ":" + string(data)})
+	}).Methods(http.MethodPost)
+	router.HandleFunc("/api/sound/sounds/{soundId}/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotAcceptable)
+		_, _ = w.Write([]byte(`{"code": 406, "message": "invalid name"}`))
+	}).Methods(http.MethodPatch)
+	router.HandleFunc("/api/sound/say/", func(w http.ResponseWriter, r *http.Request) {
+		var text string
+
+		if err := json.NewDecoder(r.Body).Decode(&text); err != nil || text != "hello world" {
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}).Methods(http.MethodPut)
+
+	return httptest.NewServer(router)
+}
+
+func TestClient(t *testing.T) {
+	sut := newServer()
+	defer sut.Close()
+
+	u, _ := url.Parse(sut.URL)
+	ctx := context.Background()
+
+	c := New(u, testToken)
+
+	sounds, err := c.ListSounds(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []sound.Sound{{Id: "s1", Name: "foo"}}, sounds)
+
+	s, err := c.UploadSound(ctx, "foo.mp3", bytes.NewBufferString("audio"))
+	assert.NoError(t, err)
+	assert.Equal(t, "foo.mp3:audio", s.Id)
+
+	assert.NoError(t, c.Say(ctx, "hello world"))
+
+	// errors include the server's message
+	err = c.RenameSound(ctx, "s1", "")
+	assert.Equal(t, Error{StatusCode: http.StatusNotAcceptable, Message: "invalid name"}, err)
+
+	// unauthorized
+	_, err = New(u, "").ListSounds(ctx)
+	assert.Equal(t, Error{StatusCode: http.StatusUnauthorized}, err)
+}
+
+func TestConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "speakerbob", "config.yaml")
+
+	// missing files are empty
+	cfg, err := LoadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, Config{}, cfg)
+
+	assert.NoError(t, Config{Server: "https://speakerbob.example.com", Token: testToken}.Save(path))
+
+	cfg, err = LoadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, Config{Server: "https://speakerbob.example.com", Token: testToken}, cfg)
+}
@@ -0,0 +1,58 @@
+package client
+
+import (
+	"gopkg.in/yaml.v2"
+	"os"
+	"path/filepath"
+)
+
+// Config is the server and token saved with the login command.
+type Config struct {
+	Server string `yaml:"server"`
+	Token  string `yaml:"token"`
+}
+
+// DefaultConfigPath returns the path of the config file in the user's home directory.
+func DefaultConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".speakerbob", "config.yaml"), nil
+}
+
+// LoadConfig reads the config file, a missing file is an empty config.
+func LoadConfig(path string) (cfg Config, err error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	err = yaml.NewDecoder(f).Decode(&cfg)
+
+	return
+}
+
+// Save writes the config file, only the user may read it because it holds their token.
+func (c Config) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err = yaml.NewEncoder(f).Encode(c); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
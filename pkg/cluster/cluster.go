@@ -0,0 +1,46 @@
+// Package cluster connects the replicas of a speakerbob deployment. Replicas share their store and blob store,
+// broadcast events to each other's websockets and elect a leader to play the queue.
+package cluster
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"strings"
+)
+
+// Cluster is how a replica reaches the other replicas, services run standalone when it is nil.
+type Cluster struct {
+	// Id identifies this replica.
+	Id string
+
+	PubSub  PubSub
+	Elector Elector
+}
+
+func New(pubSub PubSub, elector Elector) *Cluster {
+	return &Cluster{
+		Id:      strings.Replace(uuid.New().String(), "-", "", 4),
+		PubSub:  pubSub,
+		Elector: elector,
+	}
+}
+
+// PubSub delivers messages to every replica, including the one that published them. Messages published while a
+// replica is disconnected are not delivered to it.
+type PubSub interface {
+	Publish(channel string, message []byte) error
+
+	// Subscribe calls handler with every message published to channel until ctx is done, it returns once the
+	// subscription is active.
+	Subscribe(ctx context.Context, channel string, handler func(message []byte)) error
+}
+
+// Elector chooses one replica to do work that must only happen once.
+type Elector interface {
+	// Lead calls run every time this replica becomes the leader until ctx is done. The context passed to run is
+	// canceled when the replica stops being the leader.
+	Lead(ctx context.Context, run func(ctx context.Context))
+
+	// Leader returns true while this replica is the leader.
+	Leader() bool
+}
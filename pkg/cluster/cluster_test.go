@@ -0,0 +1,180 @@
+package cluster_test
+
+import (
+	"context"
+	"github.com/paynejacob/hotcereal/pkg/provider"
+	"github.com/paynejacob/hotcereal/pkg/store"
+	"github.com/paynejacob/hotcereal/pkg/stores/memory"
+	"github.com/paynejacob/speakerbob/pkg/cluster"
+	"github.com/paynejacob/speakerbob/pkg/redis"
+	"github.com/paynejacob/speakerbob/pkg/redis/redistest"
+	"github.com/paynejacob/speakerbob/pkg/sound"
+	"github.com/paynejacob/speakerbob/pkg/storage"
+	"github.com/paynejacob/speakerbob/pkg/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collect returns the messages received on channel.
+func collect(t *testing.T, ctx context.Context, pubSub cluster.PubSub, channel string) func() []string {
+	var m sync.Mutex
+	var messages []string
+
+	err := pubSub.Subscribe(ctx, channel, func(message []byte) {
+		m.Lock()
+		messages = append(messages, string(message))
+		m.Unlock()
+	})
+	assert.NoError(t, err)
+
+	return func() []string {
+		m.Lock()
+		defer m.Unlock()
+
+		return append([]string{}, messages...)
+	}
+}
+
+func testPubSub(t *testing.T, pubSub cluster.PubSub) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ctx2, cancel2 := context.WithCancel(ctx)
+
+	a := collect(t, ctx, pubSub, "foo")
+	b := collect(t, ctx2, pubSub, "foo")
+	other := collect(t, ctx, pubSub, "bar")
+
+	assert.NoError(t, pubSub.Publish("foo", []byte("1")))
+	assert.Eventually(t, func() bool { return len(a()) == 1 && len(b()) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"1"}, a())
+	assert.Empty(t, other())
+
+	// canceled subscriptions stop receiving
+	cancel2()
+	time.Sleep(50 * time.Millisecond)
+
+	assert.NoError(t, pubSub.Publish("foo", []byte("2")))
+	assert.Eventually(t, func() bool { return len(a()) == 2 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"1"}, b())
+}
+
+func TestMemoryPubSub(t *testing.T) {
+	testPubSub(t, &cluster.MemoryPubSub{})
+}
+
+func TestRedisPubSub(t *testing.T) {
+	client := redis.NewClient(redis.Options{Address: redistest.NewServer(t).Address})
+	defer client.Close()
+
+	testPubSub(t, cluster.RedisPubSub{Client: client})
+}
+
+func TestRedisElector(t *testing.T) {
+	client := redis.NewClient(redis.Options{Address: redistest.NewServer(t).Address})
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ctx1, cancel1 := context.WithCancel(ctx)
+
+	e1 := &cluster.RedisElector{Client: client, Id: "1", TTL: 300 * time.Millisecond}
+	e2 := &cluster.RedisElector{Client: client, Id: "2", TTL: 300 * time.Millisecond}
+
+	var m sync.Mutex
+	var leaders []string
+
+	lead := func(e *cluster.RedisElector, ctx context.Context) {
+		e.Lead(ctx, func(ctx context.Context) {
+			m.Lock()
+			leaders = append(leaders, e.Id)
+			m.Unlock()
+
+			<-ctx.Done()
+		})
+	}
+
+	go lead(e1, ctx1)
+	assert.Eventually(t, e1.Leader, time.Second, 10*time.Millisecond)
+
+	// the lease is renewed so the leader does not change
+	go lead(e2, ctx)
+	time.Sleep(time.Second)
+	assert.True(t, e1.Leader())
+	assert.False(t, e2.Leader())
+
+	// the leader releases the lease when it stops
+	cancel1()
+	assert.Eventually(t, e2.Leader, time.Second, 10*time.Millisecond)
+	assert.False(t, e1.Leader())
+
+	m.Lock()
+	assert.Equal(t, []string{"1", "2"}, leaders)
+	m.Unlock()
+}
+
+func TestRedisElectorLostLease(t *testing.T) {
+	client := redis.NewClient(redis.Options{Address: redistest.NewServer(t).Address})
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	e := &cluster.RedisElector{Client: client, Id: "1", TTL: 300 * time.Millisecond}
+	go e.Lead(ctx, func(ctx context.Context) { <-ctx.Done() })
+	assert.Eventually(t, e.Leader, time.Second, 10*time.Millisecond)
+
+	// another replica took the lease after it expired
+	_, err := client.Do("SET", "speakerbob.leader", "2", "PX", "60000")
+	assert.NoError(t, err)
+
+	// the replica steps down without renewing or releasing the other replica's lease
+	assert.Eventually(t, func() bool { return !e.Leader() }, time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+
+	holder, err := client.Do("GET", "speakerbob.leader")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("2"), holder)
+}
+
+func TestStoreFeed(t *testing.T) {
+	storagetest.RunFeed(t, func(*testing.T) (store.Store, storage.Feed) {
+		s := cluster.NewStore(memory.New(), cluster.New(&cluster.MemoryPubSub{}, cluster.StaticElector{}))
+
+		return s, s
+	})
+}
+
+func TestRefresh(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pubSub := &cluster.MemoryPubSub{}
+	shared := memory.New()
+
+	// two replicas sharing a store
+	s1 := cluster.NewStore(shared, cluster.New(pubSub, cluster.StaticElector{IsLeader: true}))
+	p1 := &sound.SoundProvider{Store: s1}
+	assert.NoError(t, p1.Initialize())
+
+	s2 := cluster.NewStore(shared, cluster.New(pubSub, cluster.StaticElector{}))
+	p2 := &sound.SoundProvider{Store: s2}
+	assert.NoError(t, p2.Initialize())
+
+	assert.NoError(t, storage.Refresh(ctx, s1, []provider.Provider{p1}))
+	assert.NoError(t, storage.Refresh(ctx, s2, []provider.Provider{p2}))
+
+	o := sound.NewSound()
+	o.Name = "foo"
+	assert.NoError(t, p1.Save(&o))
+
+	// the other replica reloads its cache
+	assert.Eventually(t, func() bool { return p2.Get(o.Id) != nil }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "foo", p2.Get(o.Id).Name)
+
+	assert.NoError(t, p2.Delete(p2.Get(o.Id)))
+	assert.Eventually(t, func() bool { return p1.Get(o.Id) == nil }, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,76 @@
+package cluster
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryPubSub delivers messages to subscribers in the same process, replicas in tests share one. Handlers are
+// called before Publish returns.
+type MemoryPubSub struct {
+	m           sync.RWMutex
+	subscribers map[string][]*subscriber
+}
+
+type subscriber struct {
+	handler func([]byte)
+}
+
+func (p *MemoryPubSub) Publish(channel string, message []byte) error {
+	p.m.RLock()
+	subscribers := make([]*subscriber, len(p.subscribers[channel]))
+	copy(subscribers, p.subscribers[channel])
+	p.m.RUnlock()
+
+	// handlers may publish, so they are called without holding the lock
+	for i := range subscribers {
+		subscribers[i].handler(message)
+	}
+
+	return nil
+}
+
+func (p *MemoryPubSub) Subscribe(ctx context.Context, channel string, handler func([]byte)) error {
+	sub := &subscriber{handler: handler}
+
+	p.m.Lock()
+	if p.subscribers == nil {
+		p.subscribers = map[string][]*subscriber{}
+	}
+	p.subscribers[channel] = append(p.subscribers[channel], sub)
+	p.m.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		p.m.Lock()
+		defer p.m.Unlock()
+
+		subscribers := p.subscribers[channel]
+		for i := range subscribers {
+			if subscribers[i] == sub {
+				p.subscribers[channel] = append(subscribers[:i:i], subscribers[i+1:]...)
+				break
+			}
+		}
+	}()
+
+	return nil
+}
+
+// StaticElector never changes leader, it is used by tests and single replica deployments.
+type StaticElector struct {
+	IsLeader bool
+}
+
+func (e StaticElector) Lead(ctx context.Context, run func(ctx context.Context)) {
+	if e.IsLeader {
+		run(ctx)
+	}
+
+	<-ctx.Done()
+}
+
+func (e StaticElector) Leader() bool {
+	return e.IsLeader
+}
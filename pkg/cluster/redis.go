@@ -0,0 +1,200 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"github.com/paynejacob/speakerbob/pkg/redis"
+	"github.com/sirupsen/logrus"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultLeaseTTL is how long a leader that stopped renewing its lease stays the leader.
+	DefaultLeaseTTL = 10 * time.Second
+
+	leaderKey = "speakerbob.leader"
+
+	// the lease is only changed by the replica holding it, reading and changing it in one script keeps a replica
+	// from changing the lease of the next leader after its own expired
+	renewScript   = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) else return 0 end`
+	releaseScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) else return 0 end`
+
+	// time to wait before resubscribing after losing the connection to the server
+	resubscribeInterval = time.Second
+)
+
+// RedisPubSub publishes messages through a redis compatible server.
+type RedisPubSub struct {
+	Client *redis.Client
+}
+
+func (p RedisPubSub) Publish(channel string, message []byte) error {
+	_, err := p.Client.Do("PUBLISH", channel, string(message))
+
+	return err
+}
+
+func (p RedisPubSub) Subscribe(ctx context.Context, channel string, handler func([]byte)) error {
+	sub, err := p.Client.Subscribe(channel)
+	if err != nil {
+		return err
+	}
+
+	go p.receive(ctx, channel, sub, handler)
+
+	return nil
+}
+
+// receive calls handler with the messages of sub and resubscribes when the connection is lost.
+func (p RedisPubSub) receive(ctx context.Context, channel string, sub *redis.Subscription, handler func([]byte)) {
+	go func() {
+		<-ctx.Done()
+		_ = sub.Close()
+	}()
+
+	for {
+		message, err := sub.Receive()
+		if err == nil {
+			handler(message)
+			continue
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		logrus.Errorf("[cluster.RedisPubSub] lost subscription to %s: %v", channel, err)
+
+		// wait for the server to come back
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(resubscribeInterval):
+			}
+
+			if sub, err = p.Client.Subscribe(channel); err == nil {
+				break
+			}
+		}
+
+		// the previous subscription was closed, watch the new one
+		go func(sub *redis.Subscription) {
+			<-ctx.Done()
+			_ = sub.Close()
+		}(sub)
+	}
+}
+
+// RedisElector elects the replica holding a lease key on a redis compatible server. The leader renews the lease, if
+// it stops renewing another replica takes over once the lease expires.
+type RedisElector struct {
+	Client *redis.Client
+	Id     string
+	TTL    time.Duration
+
+	leader int32
+}
+
+func (e *RedisElector) Lead(ctx context.Context, run func(ctx context.Context)) {
+	ticker := time.NewTicker(e.ttl() / 3)
+	defer ticker.Stop()
+
+	for {
+		acquired, err := e.acquire()
+		if err != nil {
+			logrus.Errorf("[cluster.RedisElector] unable to acquire the lease: %v", err)
+		}
+
+		if acquired {
+			logrus.Infof("replica %s is the leader", e.Id)
+			e.lead(ctx, run)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *RedisElector) Leader() bool {
+	return atomic.LoadInt32(&e.leader) == 1
+}
+
+// lead calls run and renews the lease until run returns, ctx is done or the lease is lost.
+func (e *RedisElector) lead(ctx context.Context, run func(ctx context.Context)) {
+	leaderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	atomic.StoreInt32(&e.leader, 1)
+
+	done := make(chan struct{})
+	go func() {
+		run(leaderCtx)
+		close(done)
+	}()
+
+	ticker := time.NewTicker(e.ttl() / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			atomic.StoreInt32(&e.leader, 0)
+			e.release()
+			return
+		case <-ticker.C:
+			renewed, err := e.renew()
+			if err != nil {
+				logrus.Errorf("[cluster.RedisElector] unable to renew the lease: %v", err)
+			}
+
+			if !renewed && e.Leader() {
+				logrus.Warnf("replica %s lost the lease", e.Id)
+
+				// stop leading before run returns so nothing is applied to a queue that is no longer played
+				atomic.StoreInt32(&e.leader, 0)
+				cancel()
+			}
+		}
+	}
+}
+
+func (e *RedisElector) acquire() (bool, error) {
+	_, err := e.Client.Do("SET", leaderKey, e.Id, "NX", "PX", e.ttlMilliseconds())
+	if errors.Is(err, redis.ErrNil) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// renew extends the lease if this replica still holds it.
+func (e *RedisElector) renew() (bool, error) {
+	reply, err := e.Client.Do("EVAL", renewScript, "1", leaderKey, e.Id, e.ttlMilliseconds())
+
+	return reply == int64(1), err
+}
+
+// release lets another replica take over without waiting for the lease to expire.
+func (e *RedisElector) release() {
+	if _, err := e.Client.Do("EVAL", releaseScript, "1", leaderKey, e.Id); err != nil {
+		logrus.Errorf("[cluster.RedisElector] unable to release the lease: %v", err)
+	}
+}
+
+func (e *RedisElector) ttl() time.Duration {
+	if e.TTL <= 0 {
+		return DefaultLeaseTTL
+	}
+
+	return e.TTL
+}
+
+func (e *RedisElector) ttlMilliseconds() string {
+	return strconv.FormatInt(int64(e.ttl()/time.Millisecond), 10)
+}
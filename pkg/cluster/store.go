@@ -0,0 +1,120 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/paynejacob/hotcereal/pkg/store"
+	"github.com/paynejacob/speakerbob/pkg/storage"
+	"github.com/sirupsen/logrus"
+	"io"
+)
+
+const changesChannel = "speakerbob.changes"
+
+// change lists the keys a replica wrote.
+type change struct {
+	Replica string   `json:"replica"`
+	Keys    [][]byte `json:"keys"`
+}
+
+// Store tells every replica which keys were written to the wrapped store so they can refresh their caches.
+type Store struct {
+	store.Store
+
+	cluster *Cluster
+}
+
+func NewStore(s store.Store, c *Cluster) *Store {
+	return &Store{Store: s, cluster: c}
+}
+
+// Unwrap returns the wrapped store.
+func (s *Store) Unwrap() store.Store {
+	return s.Store
+}
+
+func (s *Store) WriteLazy(key store.FieldKey, r io.Reader) error {
+	if err := s.Store.WriteLazy(key, r); err != nil {
+		return err
+	}
+
+	s.publish(key)
+
+	return nil
+}
+
+func (s *Store) Save(key store.Key, value []byte) error {
+	if err := s.Store.Save(key, value); err != nil {
+		return err
+	}
+
+	s.publish(key)
+
+	return nil
+}
+
+func (s *Store) BulkSave(m map[store.Key][]byte) error {
+	if err := s.Store.BulkSave(m); err != nil {
+		return err
+	}
+
+	keys := make([]store.Key, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	s.publish(keys...)
+
+	return nil
+}
+
+func (s *Store) Delete(keys ...store.Key) error {
+	if err := s.Store.Delete(keys...); err != nil {
+		return err
+	}
+
+	s.publish(keys...)
+
+	return nil
+}
+
+// publish announces written keys, the write already succeeded so failures are only logged. Replicas that miss the
+// change serve stale data until the key is written again or they restart.
+func (s *Store) publish(keys ...store.Key) {
+	c := change{Replica: s.cluster.Id, Keys: make([][]byte, len(keys))}
+	for i := range keys {
+		c.Keys[i] = keys[i].Bytes()
+	}
+
+	message, err := json.Marshal(c)
+	if err == nil {
+		err = s.cluster.PubSub.Publish(changesChannel, message)
+	}
+
+	if err != nil {
+		logrus.Errorf("[cluster.Store] unable to publish change: %v", err)
+	}
+}
+
+// Watch calls handler with the keys written by every replica, changes written by other replicas are remote.
+func (s *Store) Watch(ctx context.Context, prefixes []store.TypeKey, handler func(storage.Change)) error {
+	// the writer may be holding a provider lock until publish returns
+	queue := storage.Ordered(ctx, handler)
+
+	return s.cluster.PubSub.Subscribe(ctx, changesChannel, func(message []byte) {
+		var ch change
+
+		if err := json.Unmarshal(message, &ch); err != nil {
+			logrus.Errorf("[cluster.Store] invalid change: %v", err)
+			return
+		}
+
+		c := storage.Change{Keys: ch.Keys, Remote: ch.Replica != s.cluster.Id}
+		for _, prefix := range prefixes {
+			if c.Has(prefix) {
+				queue(c)
+				return
+			}
+		}
+	})
+}
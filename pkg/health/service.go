@@ -2,7 +2,9 @@ package health
 
 import (
 	"context"
+	"expvar"
 	"github.com/gorilla/mux"
+	"github.com/paynejacob/speakerbob/pkg/auth"
 	"net/http"
 )
 
@@ -17,3 +19,23 @@ func (s Service) Run(context.Context) {}
 func (s Service) healthz(w http.ResponseWriter, _ *http.Request) {
 	_, _ = w.Write([]byte("ok"))
 }
+
+// VarsService serves the expvar metrics to admins, they include the command line and memory stats.
+type VarsService struct {
+	AuthService *auth.Service
+}
+
+func (s VarsService) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/debug/vars/", s.vars).Methods(http.MethodGet)
+}
+
+func (s VarsService) Run(context.Context) {}
+
+func (s VarsService) vars(w http.ResponseWriter, r *http.Request) {
+	if !s.AuthService.RoleAllowed(r, auth.AdminRole) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	expvar.Handler().ServeHTTP(w, r)
+}
@@ -0,0 +1,120 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"github.com/paynejacob/hotcereal/pkg/store"
+	"github.com/paynejacob/speakerbob/pkg/storage"
+	"github.com/sirupsen/logrus"
+	"strconv"
+)
+
+var (
+	// ErrNewerSchema is returned when the data was written by a newer version of speakerbob.
+	ErrNewerSchema = errors.New("the data schema is newer than this version of speakerbob supports")
+
+	// ErrOlderSchema is returned by Check when the data has not been migrated to the latest version.
+	ErrOlderSchema = errors.New("the data schema is older than this version of speakerbob")
+)
+
+// Migration changes the stored data from the previous schema version to Version. Migrations must be idempotent, a
+// migration that fails part way is run again on the next start.
+type Migration struct {
+	Version     int
+	Description string
+	Migrate     func(store.Store) error
+}
+
+// Migrations are run in order, append new migrations to the end.
+var Migrations = []Migration{
+	{1, "remove the unused version key", removeVersionKey},
+}
+
+var schemaKey = store.TypeKey{Body: "migrationSchema", PackageLength: 9, TypeLength: 6}
+
+// Latest is the schema version this version of speakerbob supports.
+func Latest() int {
+	return Migrations[len(Migrations)-1].Version
+}
+
+// Version returns the schema version of the stored data, data from before migrations existed is version 0.
+func Version(s store.Store) (int, error) {
+	value, err := s.Get(schemaKey)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && len(value) == 0) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	version, err := strconv.Atoi(string(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema version: %w", err)
+	}
+
+	return version, nil
+}
+
+// Run migrates the stored data to the latest schema version, it must run before any provider is initialized.
+func Run(s store.Store) error {
+	return run(s, Migrations)
+}
+
+// Check returns an error unless the stored data is the latest schema version, tools that must not change the data
+// check it instead of migrating.
+func Check(s store.Store) error {
+	return check(s, Migrations)
+}
+
+func check(s store.Store, migrations []Migration) error {
+	version, err := Version(s)
+	if err != nil {
+		return err
+	}
+
+	latest := migrations[len(migrations)-1].Version
+	switch {
+	case version > latest:
+		return fmt.Errorf("%w: the data is version %d, the latest supported version is %d", ErrNewerSchema, version, latest)
+	case version < latest:
+		return fmt.Errorf("%w: the data is version %d, the latest version is %d", ErrOlderSchema, version, latest)
+	}
+
+	return nil
+}
+
+func run(s store.Store, migrations []Migration) error {
+	version, err := Version(s)
+	if err != nil {
+		return err
+	}
+
+	latest := migrations[len(migrations)-1].Version
+	if version > latest {
+		return fmt.Errorf("%w: the data is version %d, the latest supported version is %d", ErrNewerSchema, version, latest)
+	}
+
+	for _, m := range migrations {
+		if m.Version <= version {
+			continue
+		}
+
+		logrus.Infof("Migrating data to version %d: %s", m.Version, m.Description)
+
+		if err = m.Migrate(s); err != nil {
+			return fmt.Errorf("migration %d failed: %w", m.Version, err)
+		}
+
+		// record each migration so a failure does not repeat the ones before it
+		if err = s.Save(schemaKey, []byte(strconv.Itoa(m.Version))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeVersionKey deletes the speakerbob version that was written on every start but never read.
+func removeVersionKey(s store.Store) error {
+	return s.Delete(store.TypeKey{Body: "versionVersion", PackageLength: 7, TypeLength: 7})
+}
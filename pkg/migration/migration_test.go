@@ -0,0 +1,100 @@
+package migration
+
+import (
+	"errors"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/paynejacob/hotcereal/pkg/store"
+	"github.com/paynejacob/speakerbob/pkg/store/badgerdb"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func newStore(t *testing.T) badgerdb.Store {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	return badgerdb.Store{DB: db}
+}
+
+func TestRun(t *testing.T) {
+	var ran []int
+
+	s := newStore(t)
+	key := store.TypeKey{Body: "testTest", PackageLength: 4, TypeLength: 4}
+
+	migrations := []Migration{
+		{1, "one", func(store.Store) error { ran = append(ran, 1); return nil }},
+		{2, "two", func(s store.Store) error { ran = append(ran, 2); return s.Save(key, []byte("foo")) }},
+	}
+
+	// new data
+	version, err := Version(s)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, version)
+
+	assert.NoError(t, run(s, migrations))
+	assert.Equal(t, []int{1, 2}, ran)
+
+	version, err = Version(s)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, version)
+
+	// migrated data
+	assert.NoError(t, run(s, migrations))
+	assert.Equal(t, []int{1, 2}, ran)
+
+	// a failed migration is run again
+	failed := errors.New("failed")
+	migrations = append(migrations,
+		Migration{3, "three", func(store.Store) error { ran = append(ran, 3); return nil }},
+		Migration{4, "four", func(store.Store) error { return failed }},
+	)
+	assert.ErrorIs(t, run(s, migrations), failed)
+	assert.Equal(t, []int{1, 2, 3}, ran)
+
+	version, err = Version(s)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, version)
+
+	// newer data
+	assert.ErrorIs(t, run(s, migrations[:2]), ErrNewerSchema)
+}
+
+func TestCheck(t *testing.T) {
+	s := newStore(t)
+
+	migrations := []Migration{
+		{1, "one", func(store.Store) error { return nil }},
+		{2, "two", func(store.Store) error { return nil }},
+	}
+
+	assert.ErrorIs(t, check(s, migrations), ErrOlderSchema)
+
+	assert.NoError(t, run(s, migrations))
+	assert.NoError(t, check(s, migrations))
+
+	assert.ErrorIs(t, check(s, migrations[:1]), ErrNewerSchema)
+
+	// checking never migrates
+	version, err := Version(s)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, version)
+}
+
+func TestMigrations(t *testing.T) {
+	for i := range Migrations {
+		assert.Equal(t, i+1, Migrations[i].Version, "migrations must be numbered in order")
+	}
+
+	s := newStore(t)
+	assert.NoError(t, s.Save(store.TypeKey{Body: "versionVersion", PackageLength: 7, TypeLength: 7}, []byte("v1.0.0")))
+
+	assert.NoError(t, Run(s))
+
+	version, err := Version(s)
+	assert.NoError(t, err)
+	assert.Equal(t, Latest(), version)
+}
@@ -0,0 +1,315 @@
+// Package redis is a minimal client for redis compatible servers, it implements the parts of the protocol speakerbob
+// uses for shared storage and clustering.
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	dialTimeout = 5 * time.Second
+
+	// DefaultTimeout is how long a command waits for the server by default.
+	DefaultTimeout = 5 * time.Second
+
+	// idle connections kept for reuse
+	maxIdleConnections = 8
+)
+
+// ErrNil is returned for nil replies, for example reading a key that does not exist.
+var ErrNil = errors.New("redis: nil reply")
+
+// Error is an error reply from the server.
+type Error string
+
+func (e Error) Error() string {
+	return "redis: " + string(e)
+}
+
+// Options configure the connection to the server.
+type Options struct {
+	Address  string `yaml:"address"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+
+	// Timeout is how long a command waits for the server, connections are closed when it is reached.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Client is safe for concurrent use, it keeps a few idle connections open.
+type Client struct {
+	options Options
+
+	m      sync.Mutex
+	idle   []*conn
+	closed bool
+}
+
+func NewClient(options Options) *Client {
+	return &Client{options: options}
+}
+
+// Do sends a command and returns its reply. Replies are strings for status replies, int64 for integers, []byte for
+// bulk strings and []interface{} for arrays. Nil replies return ErrNil and error replies return an Error.
+func (c *Client) Do(args ...string) (interface{}, error) {
+	cn, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := cn.do(args...)
+
+	var redisErr Error
+	if err != nil && !errors.Is(err, ErrNil) && !errors.As(err, &redisErr) {
+		// the connection is in an unknown state
+		_ = cn.Close()
+		return nil, err
+	}
+
+	c.put(cn)
+
+	return reply, err
+}
+
+// Subscribe opens a connection that receives the messages published to channel.
+func (c *Client) Subscribe(channel string) (*Subscription, error) {
+	cn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	// the server confirms the subscription before sending messages
+	if _, err = cn.do("SUBSCRIBE", channel); err != nil {
+		_ = cn.Close()
+		return nil, err
+	}
+
+	// messages can be published at any time
+	if err = cn.SetDeadline(time.Time{}); err != nil {
+		_ = cn.Close()
+		return nil, err
+	}
+
+	return &Subscription{conn: cn}, nil
+}
+
+// Close closes the idle connections, connections in use are closed when they are returned.
+func (c *Client) Close() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.closed = true
+	for i := range c.idle {
+		_ = c.idle[i].Close()
+	}
+	c.idle = nil
+
+	return nil
+}
+
+func (c *Client) get() (*conn, error) {
+	c.m.Lock()
+
+	if c.closed {
+		c.m.Unlock()
+		return nil, errors.New("redis: client is closed")
+	}
+
+	if n := len(c.idle); n > 0 {
+		cn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.m.Unlock()
+
+		return cn, nil
+	}
+
+	c.m.Unlock()
+
+	return c.dial()
+}
+
+func (c *Client) put(cn *conn) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.closed || len(c.idle) >= maxIdleConnections {
+		_ = cn.Close()
+		return
+	}
+
+	c.idle = append(c.idle, cn)
+}
+
+func (c *Client) dial() (*conn, error) {
+	netConn, err := net.DialTimeout("tcp", c.options.Address, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	cn := newConn(netConn, c.options.Timeout)
+
+	if c.options.Password != "" {
+		if _, err = cn.do("AUTH", c.options.Password); err != nil {
+			_ = cn.Close()
+			return nil, err
+		}
+	}
+
+	if c.options.DB != 0 {
+		if _, err = cn.do("SELECT", strconv.Itoa(c.options.DB)); err != nil {
+			_ = cn.Close()
+			return nil, err
+		}
+	}
+
+	return cn, nil
+}
+
+// Subscription receives the messages published to a channel.
+type Subscription struct {
+	conn *conn
+}
+
+// Receive blocks until the next message is published, it returns an error once the subscription is closed.
+func (s *Subscription) Receive() ([]byte, error) {
+	for {
+		reply, err := s.conn.readReply()
+		if err != nil {
+			return nil, err
+		}
+
+		// messages are ["message", channel, payload], anything else is a reply to the subscribe command
+		values, ok := reply.([]interface{})
+		if !ok || len(values) != 3 {
+			continue
+		}
+
+		if kind, _ := values[0].([]byte); string(kind) != "message" {
+			continue
+		}
+
+		payload, _ := values[2].([]byte)
+
+		return payload, nil
+	}
+}
+
+func (s *Subscription) Close() error {
+	return s.conn.Close()
+}
+
+// conn speaks the redis serialization protocol over a network connection.
+type conn struct {
+	net.Conn
+
+	r *bufio.Reader
+	w *bufio.Writer
+
+	timeout time.Duration
+}
+
+func newConn(netConn net.Conn, timeout time.Duration) *conn {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return &conn{Conn: netConn, r: bufio.NewReader(netConn), w: bufio.NewWriter(netConn), timeout: timeout}
+}
+
+// do sends a command and reads its reply, a server that does not answer within the timeout fails the command.
+func (c *conn) do(args ...string) (interface{}, error) {
+	if err := c.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return nil, err
+	}
+
+	if err := c.writeCommand(args...); err != nil {
+		return nil, err
+	}
+
+	return c.readReply()
+}
+
+// writeCommand writes args as an array of bulk strings.
+func (c *conn) writeCommand(args ...string) error {
+	_, _ = fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		_, _ = fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	return c.w.Flush()
+}
+
+func (c *conn) readReply() (interface{}, error) {
+	return readReply(c.r)
+}
+
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: invalid reply: %q", line)
+	}
+
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, Error(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		size, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid bulk string length: %q", body)
+		}
+
+		if size < 0 {
+			return nil, ErrNil
+		}
+
+		value := make([]byte, size+2)
+		if _, err = io.ReadFull(r, value); err != nil {
+			return nil, err
+		}
+
+		return value[:size], nil
+	case '*':
+		size, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid array length: %q", body)
+		}
+
+		if size < 0 {
+			return nil, ErrNil
+		}
+
+		values := make([]interface{}, size)
+		for i := range values {
+			values[i], err = readReply(r)
+
+			// nil elements are kept as nil, for example missing keys in MGET
+			if errors.Is(err, ErrNil) {
+				err = nil
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return values, nil
+	}
+
+	return nil, fmt.Errorf("redis: invalid reply type: %q", kind)
+}
@@ -0,0 +1,143 @@
+package redis
+
+import (
+	"bufio"
+	"github.com/paynejacob/speakerbob/pkg/redis/redistest"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadReply(t *testing.T) {
+	reply, err := readReply(bufio.NewReader(strings.NewReader("*3\r\n$3\r\nfoo\r\n$-1\r\n:42\r\n")))
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{[]byte("foo"), nil, int64(42)}, reply)
+
+	reply, err = readReply(bufio.NewReader(strings.NewReader("+OK\r\n")))
+	assert.NoError(t, err)
+	assert.Equal(t, "OK", reply)
+
+	_, err = readReply(bufio.NewReader(strings.NewReader("$-1\r\n")))
+	assert.ErrorIs(t, err, ErrNil)
+
+	_, err = readReply(bufio.NewReader(strings.NewReader("-ERR nope\r\n")))
+	assert.Equal(t, Error("ERR nope"), err)
+
+	// bulk strings are binary safe
+	reply, err = readReply(bufio.NewReader(strings.NewReader("$4\r\na\r\nb\r\n")))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("a\r\nb"), reply)
+
+	_, err = readReply(bufio.NewReader(strings.NewReader("foo\r\n")))
+	assert.Error(t, err)
+}
+
+func TestClient(t *testing.T) {
+	server := redistest.NewServer(t)
+
+	c := NewClient(Options{Address: server.Address, Password: "secret", DB: 1})
+	defer c.Close()
+
+	_, err := c.Do("GET", "foo")
+	assert.ErrorIs(t, err, ErrNil)
+
+	reply, err := c.Do("SET", "foo", "bar\r\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "OK", reply)
+
+	reply, err = c.Do("GET", "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("bar\r\n"), reply)
+
+	_, err = c.Do("NOPE")
+	assert.Error(t, err)
+
+	// the connection is still usable after an error reply
+	_, err = c.Do("PING")
+	assert.NoError(t, err)
+}
+
+func TestSubscribe(t *testing.T) {
+	server := redistest.NewServer(t)
+
+	c := NewClient(Options{Address: server.Address})
+	defer c.Close()
+
+	sub, err := c.Subscribe("events")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan []byte, 1)
+	go func() {
+		message, err := sub.Receive()
+		if err == nil {
+			received <- message
+		}
+	}()
+
+	_, err = c.Do("PUBLISH", "events", "foo")
+	assert.NoError(t, err)
+
+	select {
+	case message := <-received:
+		assert.Equal(t, []byte("foo"), message)
+	case <-time.After(time.Second):
+		t.Fatal("message not received")
+	}
+
+	assert.NoError(t, sub.Close())
+
+	_, err = sub.Receive()
+	assert.Error(t, err)
+}
+
+func TestTimeout(t *testing.T) {
+	// a server that accepts connections and never answers
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	c := NewClient(Options{Address: listener.Addr().String(), Timeout: 50 * time.Millisecond})
+	defer c.Close()
+
+	start := time.Now()
+	_, err = c.Do("PING")
+	assert.Error(t, err)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+
+	// subscriptions wait for messages longer than the timeout
+	server := redistest.NewServer(t)
+
+	c = NewClient(Options{Address: server.Address, Timeout: 50 * time.Millisecond})
+	defer c.Close()
+
+	sub, err := c.Subscribe("events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	_, err = c.Do("PUBLISH", "events", "foo")
+	assert.NoError(t, err)
+
+	message, err := sub.Receive()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("foo"), message)
+}
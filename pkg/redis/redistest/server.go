@@ -0,0 +1,343 @@
+// Package redistest is an in memory server implementing the redis commands speakerbob uses, for tests.
+package redistest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// noReply is returned by commands that wrote their own reply.
+var noReply = struct{}{}
+
+// compareScript matches the scripts eval supports.
+var compareScript = regexp.MustCompile(`^if redis\.call\("GET", KEYS\[1\]\) == ARGV\[1\] then return redis\.call\("(\w+)", KEYS\[1\](, ARGV\[2\])?\) else return 0 end$`)
+
+type Server struct {
+	Address string
+
+	listener net.Listener
+
+	m           sync.Mutex
+	values      map[string]string
+	expires     map[string]time.Time
+	subscribers map[string][]*client
+}
+
+type client struct {
+	m sync.Mutex
+	w *bufio.Writer
+}
+
+// NewServer starts a server that is stopped when the test finishes.
+func NewServer(t *testing.T) *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{
+		Address:     listener.Addr().String(),
+		listener:    listener,
+		values:      map[string]string{},
+		expires:     map[string]time.Time{},
+		subscribers: map[string][]*client{},
+	}
+
+	go s.serve()
+	t.Cleanup(func() { _ = listener.Close() })
+
+	return s
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	c := &client{w: bufio.NewWriter(conn)}
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		reply := s.exec(c, args)
+		if reply == noReply {
+			continue
+		}
+
+		c.m.Lock()
+		writeReply(c.w, reply)
+		err = c.w.Flush()
+		c.m.Unlock()
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// exec runs a command, nil replies are returned as nil and errors as error values.
+func (s *Server) exec(c *client, args []string) interface{} {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.expire()
+
+	return s.command(c, args)
+}
+
+func (s *Server) command(c *client, args []string) interface{} {
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "PONG"
+	case "AUTH", "SELECT":
+		return "OK"
+	case "GET":
+		if v, ok := s.values[args[1]]; ok {
+			return []byte(v)
+		}
+
+		return nil
+	case "SET":
+		return s.set(args[1], args[2], args[3:])
+	case "MSET":
+		for i := 1; i+1 < len(args); i += 2 {
+			s.values[args[i]] = args[i+1]
+			delete(s.expires, args[i])
+		}
+
+		return "OK"
+	case "MGET":
+		values := make([]interface{}, 0, len(args)-1)
+		for _, k := range args[1:] {
+			if v, ok := s.values[k]; ok {
+				values = append(values, []byte(v))
+			} else {
+				values = append(values, nil)
+			}
+		}
+
+		return values
+	case "DEL":
+		var n int64
+		for _, k := range args[1:] {
+			if _, ok := s.values[k]; ok {
+				n++
+			}
+
+			delete(s.values, k)
+			delete(s.expires, k)
+		}
+
+		return n
+	case "PEXPIRE":
+		if _, ok := s.values[args[1]]; !ok {
+			return int64(0)
+		}
+
+		ms, _ := strconv.Atoi(args[2])
+		s.expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+
+		return int64(1)
+	case "SCAN":
+		// every key is returned at once, only prefix patterns are supported
+		pattern := "*"
+		for i := 2; i+1 < len(args); i += 2 {
+			if strings.ToUpper(args[i]) == "MATCH" {
+				pattern = args[i+1]
+			}
+		}
+
+		keys := make([]string, 0)
+		for k := range s.values {
+			if strings.HasPrefix(k, unescape(strings.TrimSuffix(pattern, "*"))) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		found := make([]interface{}, len(keys))
+		for i := range keys {
+			found[i] = []byte(keys[i])
+		}
+
+		return []interface{}{[]byte("0"), found}
+	case "EVAL":
+		return s.eval(c, args[1], args[2], args[3:])
+	case "PUBLISH":
+		subscribers := s.subscribers[args[1]]
+		for _, subscriber := range subscribers {
+			subscriber.m.Lock()
+			writeReply(subscriber.w, []interface{}{[]byte("message"), []byte(args[1]), []byte(args[2])})
+			_ = subscriber.w.Flush()
+			subscriber.m.Unlock()
+		}
+
+		return int64(len(subscribers))
+	case "SUBSCRIBE":
+		s.subscribers[args[1]] = append(s.subscribers[args[1]], c)
+
+		// confirm before a message can be published to the client
+		c.m.Lock()
+		writeReply(c.w, []interface{}{[]byte("subscribe"), []byte(args[1]), int64(1)})
+		_ = c.w.Flush()
+		c.m.Unlock()
+
+		return noReply
+	}
+
+	return fmt.Errorf("ERR unknown command '%s'", args[0])
+}
+
+// eval runs scripts that compare the value of a key before running one command on it, lua is not supported.
+func (s *Server) eval(c *client, script string, numKeys string, args []string) interface{} {
+	match := compareScript.FindStringSubmatch(script)
+	if match == nil || numKeys != "1" {
+		return fmt.Errorf("ERR unsupported script: %s", script)
+	}
+
+	if v, ok := s.values[args[0]]; !ok || v != args[1] {
+		return int64(0)
+	}
+
+	command := []string{match[1], args[0]}
+	if match[2] != "" {
+		command = append(command, args[2])
+	}
+
+	return s.command(c, command)
+}
+
+// set supports the NX, XX and PX options.
+func (s *Server) set(key string, value string, options []string) interface{} {
+	var ttl time.Duration
+
+	_, exists := s.values[key]
+
+	for i := 0; i < len(options); i++ {
+		switch strings.ToUpper(options[i]) {
+		case "NX":
+			if exists {
+				return nil
+			}
+		case "XX":
+			if !exists {
+				return nil
+			}
+		case "PX":
+			i++
+			ms, _ := strconv.Atoi(options[i])
+			ttl = time.Duration(ms) * time.Millisecond
+		}
+	}
+
+	s.values[key] = value
+	delete(s.expires, key)
+
+	if ttl > 0 {
+		s.expires[key] = time.Now().Add(ttl)
+	}
+
+	return "OK"
+}
+
+func (s *Server) expire() {
+	now := time.Now()
+
+	for k, expires := range s.expires {
+		if now.After(expires) {
+			delete(s.values, k)
+			delete(s.expires, k)
+		}
+	}
+}
+
+// unescape removes the backslashes escaping wildcards in a pattern.
+func unescape(pattern string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] == '\\' && i+1 < len(pattern) {
+			i++
+		}
+
+		b.WriteByte(pattern[i])
+	}
+
+	return b.String()
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil || line[0] != '*' {
+		return nil, fmt.Errorf("invalid command: %q", line)
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		line, err = r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+
+		value := make([]byte, size+2)
+		if _, err = io.ReadFull(r, value); err != nil {
+			return nil, err
+		}
+
+		args[i] = string(value[:size])
+	}
+
+	return args, nil
+}
+
+func writeReply(w *bufio.Writer, reply interface{}) {
+	switch v := reply.(type) {
+	case nil:
+		_, _ = w.WriteString("$-1\r\n")
+	case string:
+		_, _ = fmt.Fprintf(w, "+%s\r\n", v)
+	case error:
+		_, _ = fmt.Fprintf(w, "-%s\r\n", v.Error())
+	case int64:
+		_, _ = fmt.Fprintf(w, ":%d\r\n", v)
+	case []byte:
+		_, _ = fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case []interface{}:
+		_, _ = fmt.Fprintf(w, "*%d\r\n", len(v))
+		for i := range v {
+			writeReply(w, v[i])
+		}
+	}
+}
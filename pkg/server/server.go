@@ -8,10 +8,15 @@ import (
 	"github.com/paynejacob/hotcereal/pkg/provider"
 	"github.com/paynejacob/hotcereal/pkg/store"
 	"github.com/paynejacob/speakerbob/pkg/auth"
+	"github.com/paynejacob/speakerbob/pkg/backup"
+	"github.com/paynejacob/speakerbob/pkg/blob"
+	"github.com/paynejacob/speakerbob/pkg/cluster"
 	"github.com/paynejacob/speakerbob/pkg/health"
 	"github.com/paynejacob/speakerbob/pkg/service"
 	"github.com/paynejacob/speakerbob/pkg/sound"
 	"github.com/paynejacob/speakerbob/pkg/static"
+	"github.com/paynejacob/speakerbob/pkg/storage"
+	"github.com/paynejacob/speakerbob/pkg/store/badgerdb"
 	"github.com/paynejacob/speakerbob/pkg/websocket"
 	"github.com/sirupsen/logrus"
 	"net/http"
@@ -22,24 +27,47 @@ type Config struct {
 	Host          string
 	Port          int
 	DurationLimit time.Duration
+	PlayLeadTime  time.Duration
 	AuthProviders []auth.Provider
+
+	GuestPermissions []auth.Permission
+
+	// AllowedOrigins are the cross site origins allowed to use the api and websocket.
+	AllowedOrigins []string
+
+	// Cluster connects the server to the other replicas, the server runs standalone if it is nil.
+	Cluster *cluster.Cluster
 }
 
 type Server struct {
 	httpServer     http.Server
 	providers      []provider.Provider
 	serviceManager service.Manager
+	feed           storage.Feed
+
+	// providers reloaded when another process writes to them, the sound service reloads its own
+	refreshed []provider.Provider
 }
 
 func NewServer(_store store.Store, config Config) *Server {
 	var svr Server
 
+	// stores without a change feed get one that sees the writes of this server
+	feed, ok := storage.FindFeed(_store)
+	if !ok {
+		feedStore := storage.NewFeedStore(_store)
+		_store, feed = feedStore, feedStore
+	}
+	svr.feed = feed
+
 	// Providers
 	tokenProvider := auth.TokenProvider{Store: _store}
 	userProvider := auth.UserProvider{Store: _store}
+	roleBindingProvider := auth.RoleBindingProvider{Store: _store}
 	soundProvider := sound.SoundProvider{Store: _store}
 	groupProvider := sound.GroupProvider{Store: _store}
-	svr.providers = []provider.Provider{&tokenProvider, &userProvider, &soundProvider, &groupProvider}
+	svr.providers = []provider.Provider{&tokenProvider, &userProvider, &roleBindingProvider, &soundProvider, &groupProvider}
+	svr.refreshed = []provider.Provider{&tokenProvider, &userProvider, &roleBindingProvider}
 
 	router := mux.NewRouter()
 	authRouter := router.PathPrefix("/auth").Subrouter()
@@ -47,20 +75,35 @@ func NewServer(_store store.Store, config Config) *Server {
 
 	// Services
 	authService := &auth.Service{
-		TokenProvider: &tokenProvider,
-		UserProvider:  &userProvider,
-		Providers:     config.AuthProviders,
+		TokenProvider:       &tokenProvider,
+		UserProvider:        &userProvider,
+		RoleBindingProvider: &roleBindingProvider,
+		Providers:           config.AuthProviders,
+
+		GuestPermissions: config.GuestPermissions,
 	}
 	svr.serviceManager.RegisterService(authRouter, authService)
-	websocketService := &websocket.Service{AuthService: authService}
+	websocketService := &websocket.Service{AuthService: authService, AllowedOrigins: config.AllowedOrigins, Cluster: config.Cluster}
 	svr.serviceManager.RegisterService(router, websocketService)
+	svr.serviceManager.RegisterService(apiRouter, websocket.PresenceService{WebsocketService: websocketService})
 	svr.serviceManager.RegisterService(apiRouter, &sound.Service{
 		SoundProvider:    &soundProvider,
 		GroupProvider:    &groupProvider,
 		WebsocketService: websocketService,
 		MaxSoundDuration: config.DurationLimit,
+		PlayLeadTime:     config.PlayLeadTime,
+		Cluster:          config.Cluster,
+		Feed:             feed,
 	})
+	if badgerStore, ok := unwrap(_store).(badgerdb.Store); ok {
+		// backups hold the audio of sounds, they can only be made when the server keeps it in blobs
+		if blobs, ok := lazyStore(_store); ok {
+			svr.serviceManager.RegisterService(apiRouter, backup.Service{DB: badgerStore.DB, Blobs: blobs.Blobs, AuthService: authService})
+		}
+		svr.serviceManager.RegisterService(router, badgerdb.GCService{DB: badgerStore.DB})
+	}
 	svr.serviceManager.RegisterService(router, health.Service{})
+	svr.serviceManager.RegisterService(apiRouter, health.VarsService{AuthService: authService})
 
 	router.NotFoundHandler = static.Service{}
 
@@ -72,6 +115,15 @@ func NewServer(_store store.Store, config Config) *Server {
 
 	svr.httpServer.Addr = fmt.Sprintf("%s:%d", config.Host, config.Port)
 	svr.httpServer.Handler = router
+	if len(config.AllowedOrigins) > 0 {
+		// cors wraps the router so preflight requests are handled before routes are matched
+		svr.httpServer.Handler = handlers.CORS(
+			handlers.AllowedOrigins(config.AllowedOrigins),
+			handlers.AllowedMethods([]string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}),
+			handlers.AllowedHeaders([]string{"Authorization", "Content-Type"}),
+			handlers.AllowCredentials(),
+		)(router)
+	}
 	svr.httpServer.ReadTimeout = 5 * time.Second
 	svr.httpServer.ReadHeaderTimeout = 2 * time.Second
 	svr.httpServer.WriteTimeout = 10 * time.Second
@@ -80,6 +132,34 @@ func NewServer(_store store.Store, config Config) *Server {
 	return &svr
 }
 
+// unwrap returns the innermost store s wraps, or s if it does not wrap a store.
+func unwrap(s store.Store) store.Store {
+	for {
+		wrapper, ok := s.(interface{ Unwrap() store.Store })
+		if !ok {
+			return s
+		}
+
+		s = wrapper.Unwrap()
+	}
+}
+
+// lazyStore returns the first store s wraps that keeps lazy fields in blobs.
+func lazyStore(s store.Store) (*blob.LazyStore, bool) {
+	for {
+		if l, ok := s.(*blob.LazyStore); ok {
+			return l, true
+		}
+
+		wrapper, ok := s.(interface{ Unwrap() store.Store })
+		if !ok {
+			return nil, false
+		}
+
+		s = wrapper.Unwrap()
+	}
+}
+
 func (s *Server) Run(ctx context.Context) error {
 	logrus.Info("Initializing providers")
 	for _, p := range s.providers {
@@ -89,6 +169,11 @@ func (s *Server) Run(ctx context.Context) error {
 		}
 	}
 
+	if err := storage.Refresh(ctx, s.feed, s.refreshed); err != nil {
+		logrus.Errorf("Error watching the store for changes: %s", err.Error())
+		return err
+	}
+
 	logrus.Info("Starting services")
 	go s.serviceManager.Run(ctx)
 
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"github.com/paynejacob/hotcereal/pkg/store"
+	"github.com/paynejacob/hotcereal/pkg/stores/memory"
+	"github.com/paynejacob/speakerbob/pkg/blob"
+	"github.com/paynejacob/speakerbob/pkg/client"
+	"github.com/paynejacob/speakerbob/pkg/sound"
+	"github.com/paynejacob/speakerbob/pkg/store/boltdb"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// newTestServer serves the router of a server without starting its services.
+func newTestServer(t *testing.T, svr *Server) *httptest.Server {
+	for _, p := range svr.providers {
+		if err := p.Initialize(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return httptest.NewServer(svr.httpServer.Handler)
+}
+
+// soundProvider returns the sound provider of a server.
+func soundProvider(svr *Server) *sound.SoundProvider {
+	for _, p := range svr.providers {
+		if sp, ok := p.(*sound.SoundProvider); ok {
+			return sp
+		}
+	}
+
+	return nil
+}
+
+func TestExportImportCompressed(t *testing.T) {
+	svr := NewServer(memory.New(), Config{DurationLimit: 10 * time.Second})
+
+	sut := newTestServer(t, svr)
+	defer sut.Close()
+
+	sounds := soundProvider(svr)
+
+	s1 := sound.NewSound()
+	s1.Name = "s1"
+	s1.Hidden = false
+	assert.NoError(t, sounds.Save(&s1))
+	assert.NoError(t, sounds.WriteAudio(&s1, bytes.NewReader([]byte{1, 2, 3})))
+
+	u, _ := url.Parse(sut.URL)
+	c := client.New(u, "")
+
+	// the client accepts gzip, the hijacked responses must not claim to be compressed
+	var export bytes.Buffer
+	assert.NoError(t, c.ExportSounds(context.Background(), &export))
+
+	archive, err := zip.NewReader(bytes.NewReader(export.Bytes()), int64(export.Len()))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, archive.File)
+
+	result, err := c.ImportSounds(context.Background(), bytes.NewReader(export.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Duplicates)
+}
+
+func TestDownloadRangeBolt(t *testing.T) {
+	db, err := boltdb.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// bolt has no change feed, the server wraps the store in one
+	svr := NewServer(blob.NewLazyStore(db, blob.FileStore{Path: t.TempDir()}), Config{DurationLimit: 10 * time.Second})
+
+	sut := newTestServer(t, svr)
+	defer sut.Close()
+
+	sounds := soundProvider(svr)
+
+	s1 := sound.NewSound()
+	s1.Name = "s1"
+	s1.Hidden = false
+	assert.NoError(t, sounds.Save(&s1))
+	assert.NoError(t, sounds.WriteAudio(&s1, bytes.NewReader([]byte{1, 2, 3, 4})))
+
+	req, _ := http.NewRequest(http.MethodGet, sut.URL+"/api/sound/sounds/"+s1.Id+"/download/", nil)
+	req.Header.Set("Range", "bytes=1-2")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, []byte{2, 3}, body)
+
+	// audio written to bolt before blobs existed is moved through the feed
+	s2 := sound.NewSound()
+	assert.NoError(t, sounds.Save(&s2))
+	assert.NoError(t, db.WriteLazy(sounds.FieldKey(&s2, "Audio"), bytes.NewReader([]byte{5, 6})))
+
+	mover, ok := sounds.Store.(interface {
+		MoveLazy(store.FieldKey) (bool, error)
+	})
+	if assert.True(t, ok) {
+		moved, err := mover.MoveLazy(sounds.FieldKey(&s2, "Audio"))
+		assert.NoError(t, err)
+		assert.True(t, moved)
+	}
+
+	opener := sounds.Store.(interface {
+		OpenLazy(store.FieldKey) (io.ReadSeekCloser, error)
+	})
+	audio, err := opener.OpenLazy(sounds.FieldKey(&s2, "Audio"))
+	if assert.NoError(t, err) {
+		data, _ := ioutil.ReadAll(audio)
+		_ = audio.Close()
+		assert.Equal(t, []byte{5, 6}, data)
+	}
+}
@@ -27,6 +27,16 @@ type errorResponse struct {
 	Message string `json:"message"`
 }
 
+// ErrorMessage returns the message for err that is safe to show to users.
+func ErrorMessage(err error) string {
+	switch err.(type) {
+	case SpeakerbobError, NotAcceptableError:
+		return err.Error()
+	}
+
+	return "An unexpected error has occurred."
+}
+
 func WriteErrorResponse(w http.ResponseWriter, err error) {
 	resp := errorResponse{
 		Code:    http.StatusInternalServerError,
@@ -0,0 +1,350 @@
+package sound
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/paynejacob/speakerbob/pkg/service"
+	"io"
+	"time"
+)
+
+const (
+	// ArchiveFormatVersion is incremented when the export layout changes, newer archives can not be imported.
+	ArchiveFormatVersion = 1
+
+	archiveManifestName = "manifest.json"
+)
+
+// ArchiveManifest describes the sounds and groups in an exported soundboard.
+type ArchiveManifest struct {
+	FormatVersion int            `json:"format_version"`
+	CreatedAt     time.Time      `json:"created_at"`
+	Sounds        []ArchiveSound `json:"sounds"`
+	Groups        []ArchiveGroup `json:"groups"`
+}
+
+// ArchiveSound is a sound in an exported soundboard, File is the path of its mp3 in the archive.
+type ArchiveSound struct {
+	Id       string        `json:"id"`
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+	SHA256   string        `json:"sha256"`
+	File     string        `json:"file"`
+}
+
+// ArchiveGroup is a group in an exported soundboard, sounds are referenced by the sha256 of their audio so they
+// can be matched to sounds that already exist when the soundboard is imported.
+type ArchiveGroup struct {
+	Name   string   `json:"name"`
+	Sounds []string `json:"sounds"`
+}
+
+// ImportResult is the sounds and groups created by an import. Sounds that already existed are not created again.
+type ImportResult struct {
+	Sounds     []*Sound `json:"sounds"`
+	Groups     []*Group `json:"groups"`
+	Duplicates int      `json:"duplicates"`
+}
+
+// Export writes a zip of every visible sound's audio and the groups to w.
+func Export(w io.Writer, soundProvider *SoundProvider, groupProvider *GroupProvider) (manifest ArchiveManifest, err error) {
+	var f io.Writer
+
+	manifest = ArchiveManifest{
+		FormatVersion: ArchiveFormatVersion,
+		CreatedAt:     time.Now(),
+		Sounds:        make([]ArchiveSound, 0),
+		Groups:        make([]ArchiveGroup, 0),
+	}
+
+	hashes := map[string]string{}
+
+	zw := zip.NewWriter(w)
+
+	for _, sound := range soundProvider.List() {
+		if sound.Hidden {
+			continue
+		}
+
+		archiveSound := ArchiveSound{
+			Id:       sound.Id,
+			Name:     sound.Name,
+			Duration: sound.Duration,
+			File:     "sounds/" + sound.Id + ".mp3",
+		}
+
+		// mp3s do not compress
+		if f, err = zw.CreateHeader(&zip.FileHeader{Name: archiveSound.File, Method: zip.Store, Modified: sound.CreatedAt}); err != nil {
+			return
+		}
+
+		hash := sha256.New()
+		if err = soundProvider.ReadAudio(sound, io.MultiWriter(f, hash)); err != nil {
+			return
+		}
+
+		archiveSound.SHA256 = hex.EncodeToString(hash.Sum(nil))
+		hashes[sound.Id] = archiveSound.SHA256
+
+		manifest.Sounds = append(manifest.Sounds, archiveSound)
+	}
+
+groups:
+	for _, group := range groupProvider.List() {
+		archiveGroup := ArchiveGroup{Name: group.Name}
+
+		for _, soundId := range group.SoundIds {
+			hash, ok := hashes[soundId]
+			if !ok {
+				// the group references a sound that was not exported
+				continue groups
+			}
+
+			archiveGroup.Sounds = append(archiveGroup.Sounds, hash)
+		}
+
+		manifest.Groups = append(manifest.Groups, archiveGroup)
+	}
+
+	if f, err = zw.Create(archiveManifestName); err != nil {
+		return
+	}
+
+	if err = json.NewEncoder(f).Encode(manifest); err != nil {
+		return
+	}
+
+	err = zw.Close()
+
+	return
+}
+
+// Import creates the sounds and groups of an exported soundboard. Audio is normalized as if it was uploaded, sounds
+// with the same audio as an existing sound, before or after it is normalized, are not imported and groups reference
+// the existing sound instead.
+func Import(r io.ReaderAt, size int64, soundProvider *SoundProvider, groupProvider *GroupProvider, maxDuration time.Duration) (result ImportResult, err error) {
+	var manifest ArchiveManifest
+
+	result.Sounds = make([]*Sound, 0)
+	result.Groups = make([]*Group, 0)
+
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return result, service.NewNotAcceptableError("not a zip archive")
+	}
+
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	if err = readManifest(files[archiveManifestName], &manifest); err != nil {
+		return
+	}
+
+	// validate the whole archive before creating anything
+	hashes := make([]string, len(manifest.Sounds))
+	archived := map[string]bool{}
+	for i, archiveSound := range manifest.Sounds {
+		f := files[archiveSound.File]
+		if f == nil {
+			return result, service.NewNotAcceptableError("missing audio file: " + archiveSound.File)
+		}
+
+		if !(0 < len(archiveSound.Name) && len(archiveSound.Name) < 30) {
+			return result, service.NewNotAcceptableError("invalid sound name: " + archiveSound.Name)
+		}
+
+		if hashes[i], err = hashFile(f); err != nil {
+			return
+		}
+
+		if hashes[i] != archiveSound.SHA256 {
+			return result, service.NewNotAcceptableError("checksum does not match for " + archiveSound.File)
+		}
+
+		archived[hashes[i]] = true
+	}
+
+	for _, archiveGroup := range manifest.Groups {
+		if len(archiveGroup.Sounds) < 2 {
+			return result, service.NewNotAcceptableError("groups must consist of 2 or more sounds: " + archiveGroup.Name)
+		}
+
+		for _, hash := range archiveGroup.Sounds {
+			if !archived[hash] {
+				return result, service.NewNotAcceptableError("group " + archiveGroup.Name + " references a sound that is not in the archive")
+			}
+		}
+	}
+
+	// sound ids by the sha256 of their audio
+	soundIds, err := audioHashes(soundProvider)
+	if err != nil {
+		return
+	}
+
+	for i, archiveSound := range manifest.Sounds {
+		var sound *Sound
+		var duration time.Duration
+		var hash string
+
+		if _, ok := soundIds[hashes[i]]; ok {
+			result.Duplicates++
+			continue
+		}
+
+		// the audio of sounds imported from another server is normalized again, compare the normalized audio to
+		// find sounds imported from this archive before
+		var audio bytes.Buffer
+		if duration, hash, err = normalizeFile(files[archiveSound.File], maxDuration, &audio); err != nil {
+			return
+		}
+
+		if soundId, ok := soundIds[hash]; ok {
+			soundIds[hashes[i]] = soundId
+			result.Duplicates++
+			continue
+		}
+
+		if sound, err = soundProvider.newSound(duration, &audio); err != nil {
+			return
+		}
+
+		sound.Name = archiveSound.Name
+		sound.Hidden = false
+
+		if err = soundProvider.Save(sound); err != nil {
+			return
+		}
+
+		soundIds[hashes[i]] = sound.Id
+		soundIds[hash] = sound.Id
+		result.Sounds = append(result.Sounds, sound)
+	}
+
+	for _, archiveGroup := range manifest.Groups {
+		group := NewGroup()
+		group.Name = archiveGroup.Name
+
+		for _, hash := range archiveGroup.Sounds {
+			group.SoundIds = append(group.SoundIds, soundIds[hash])
+		}
+
+		if groupExists(groupProvider, &group) {
+			continue
+		}
+
+		if err = groupProvider.Save(&group); err != nil {
+			return
+		}
+
+		result.Groups = append(result.Groups, &group)
+	}
+
+	return
+}
+
+func readManifest(f *zip.File, manifest *ArchiveManifest) error {
+	if f == nil {
+		return service.NewNotAcceptableError("not a speakerbob export, the archive has no manifest")
+	}
+
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err = json.NewDecoder(r).Decode(manifest); err != nil {
+		return service.NewNotAcceptableError("invalid manifest: " + err.Error())
+	}
+
+	if manifest.FormatVersion > ArchiveFormatVersion {
+		return service.NewNotAcceptableError(fmt.Sprintf("the export format %d is newer than this version of speakerbob supports", manifest.FormatVersion))
+	}
+
+	return nil
+}
+
+func audioHashes(soundProvider *SoundProvider) (map[string]string, error) {
+	hashes := map[string]string{}
+
+	for _, sound := range soundProvider.List() {
+		if sound.Hidden {
+			continue
+		}
+
+		hash := sha256.New()
+		if err := soundProvider.ReadAudio(sound, hash); err != nil {
+			return nil, err
+		}
+
+		hashes[hex.EncodeToString(hash.Sum(nil))] = sound.Id
+	}
+
+	return hashes, nil
+}
+
+// normalizeFile writes the normalized audio of f to w and returns its duration and sha256.
+func normalizeFile(f *zip.File, maxDuration time.Duration, w io.Writer) (time.Duration, string, error) {
+	r, err := f.Open()
+	if err != nil {
+		return 0, "", err
+	}
+	defer r.Close()
+
+	hash := sha256.New()
+	duration, err := normalizeAudio(f.Name, maxDuration, r, io.MultiWriter(w, hash))
+	if err != nil {
+		return 0, "", service.NewNotAcceptableError("unable to interpret audio format: " + f.Name)
+	}
+
+	return duration, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func hashFile(f *zip.File) (string, error) {
+	r, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, r); err != nil {
+		if errors.Is(err, zip.ErrChecksum) {
+			return "", service.NewNotAcceptableError("corrupt audio file: " + f.Name)
+		}
+
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func groupExists(groupProvider *GroupProvider, group *Group) bool {
+	for _, existing := range groupProvider.List() {
+		if existing.Name != group.Name || len(existing.SoundIds) != len(group.SoundIds) {
+			continue
+		}
+
+		same := true
+		for i := range existing.SoundIds {
+			if existing.SoundIds[i] != group.SoundIds[i] {
+				same = false
+				break
+			}
+		}
+
+		if same {
+			return true
+		}
+	}
+
+	return false
+}
@@ -3,6 +3,7 @@ package sound
 import (
 	"bytes"
 	"fmt"
+	"github.com/paynejacob/hotcereal/pkg/store"
 	"github.com/sirupsen/logrus"
 	"io"
 	"os/exec"
@@ -13,6 +14,24 @@ import (
 
 var specialCharacterRegexp = regexp.MustCompile(`[^a-zA-Z0-9\\s.? ]+`)
 
+// lazyOpener is implemented by stores that can read lazy fields from any offset.
+type lazyOpener interface {
+	OpenLazy(key store.FieldKey) (io.ReadSeekCloser, error)
+}
+
+// lazyMover is implemented by stores that move lazy fields written by older versions.
+type lazyMover interface {
+	MoveLazy(key store.FieldKey) (bool, error)
+}
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
 var durationRegexp = regexp.MustCompile(`time=(?P<h>\d+):(?P<m>\d+):(?P<s>\d+).(?P<ms>\d+)`)
 
 func normalizeAudio(filename string, maxDuration time.Duration, r io.Reader, w io.Writer) (time.Duration, error) {
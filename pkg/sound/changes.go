@@ -0,0 +1,301 @@
+package sound
+
+import (
+	"bytes"
+	"context"
+	"github.com/paynejacob/hotcereal/pkg/store"
+	"github.com/paynejacob/speakerbob/pkg/storage"
+	"github.com/paynejacob/speakerbob/pkg/websocket"
+	"github.com/sirupsen/logrus"
+	"sync"
+)
+
+// changes are the sounds and groups clients were told about, writes are compared to them to pick the messages
+// clients are sent.
+type changes struct {
+	m sync.Mutex
+
+	sounds map[string]Sound
+	groups map[string]Group
+}
+
+// watch sends clients a message for every sound and group written to the store until ctx is done.
+func (s *Service) watch(ctx context.Context) {
+	s.changes.m.Lock()
+	s.changes.sounds = s.visibleSounds()
+	s.changes.groups = s.groups()
+	s.changes.m.Unlock()
+
+	prefixes := []store.TypeKey{s.SoundProvider.TypeKey(), s.GroupProvider.TypeKey()}
+
+	if err := s.Feed.Watch(ctx, prefixes, s.applyChange); err != nil {
+		logrus.Errorf("[sound.watch] unable to watch for changes: %v", err)
+	}
+}
+
+// applyChange reloads the providers written by another process and sends clients the differences for the sounds and
+// groups in the change. Another replica already sent its clients the messages for its own writes.
+func (s *Service) applyChange(c storage.Change) {
+	s.changes.m.Lock()
+	defer s.changes.m.Unlock()
+
+	soundsChanged, groupsChanged := c.Has(s.SoundProvider.TypeKey()), c.Has(s.GroupProvider.TypeKey())
+	if !soundsChanged && !groupsChanged {
+		return
+	}
+
+	if c.Remote && soundsChanged {
+		if err := s.SoundProvider.Initialize(); err != nil {
+			logrus.Errorf("[sound.applyChange] unable to reload sounds: %v", err)
+		}
+	}
+
+	if c.Remote && groupsChanged {
+		if err := s.GroupProvider.Initialize(); err != nil {
+			logrus.Errorf("[sound.applyChange] unable to reload groups: %v", err)
+		}
+	}
+
+	s.sync(s.changedSounds(c), s.changedGroups(c), !c.Remote)
+}
+
+// sync compares the sounds and groups with the given ids to the ones clients know about. Clients never see a group
+// with a sound they were not told about: the sounds of changed groups are compared too and sent before them, groups
+// holding a removed sound are deleted before it. Hidden sounds are unknown to clients, they are created when they
+// become visible.
+func (s *Service) sync(soundIds, groupIds map[string]bool, notify bool) {
+	groups := map[string]Group{}
+	for id := range groupIds {
+		if group, ok := s.group(id); ok {
+			groups[id] = group
+
+			for _, soundId := range group.SoundIds {
+				soundIds[soundId] = true
+			}
+		}
+	}
+
+	sounds := map[string]Sound{}
+	removed := false
+	for id := range soundIds {
+		if sound, ok := s.visibleSound(id); ok {
+			sounds[id] = sound
+		} else if _, ok = s.changes.sounds[id]; ok {
+			removed = true
+		}
+	}
+
+	if removed {
+		for id, group := range s.changes.groups {
+			for _, soundId := range group.SoundIds {
+				if _, ok := sounds[soundId]; soundIds[soundId] && !ok {
+					groupIds[id] = true
+					if current, ok := s.group(id); ok {
+						groups[id] = current
+					}
+					break
+				}
+			}
+		}
+	}
+
+	var messages []interface{}
+
+	for id := range groupIds {
+		previous, known := s.changes.groups[id]
+		if _, ok := groups[id]; known && !ok {
+			messages = append(messages, GroupMessage{Type: websocket.DeleteGroupMessageType, Group: &previous})
+			delete(s.changes.groups, id)
+		}
+	}
+
+	for id, sound := range sounds {
+		previous, known := s.changes.sounds[id]
+		if known && sameSound(previous, sound) {
+			continue
+		}
+
+		messageType := websocket.UpdateSoundMessageType
+		if !known {
+			messageType = websocket.CreateSoundMessageType
+		}
+
+		sound := sound
+		messages = append(messages, SoundMessage{Type: messageType, Sound: &sound})
+		s.changes.sounds[id] = sound
+	}
+
+	for id := range soundIds {
+		previous, known := s.changes.sounds[id]
+		if _, ok := sounds[id]; known && !ok {
+			messages = append(messages, SoundMessage{Type: websocket.DeleteSoundMessageType, Sound: &previous})
+			delete(s.changes.sounds, id)
+		}
+	}
+
+	for id, group := range groups {
+		previous, known := s.changes.groups[id]
+		if known && sameGroup(previous, group) {
+			continue
+		}
+
+		messageType := websocket.UpdateGroupMessageType
+		if !known {
+			messageType = websocket.CreateGroupMessageType
+		}
+
+		group := group
+		messages = append(messages, GroupMessage{Type: messageType, Group: &group})
+		s.changes.groups[id] = group
+	}
+
+	if !notify {
+		return
+	}
+
+	for i := range messages {
+		s.WebsocketService.BroadcastMessage(messages[i])
+	}
+}
+
+// changedSounds returns the ids of the sounds written in c, every sound is compared if a key can not be read.
+func (s *Service) changedSounds(c storage.Change) map[string]bool {
+	ids, ok := changedIds(c, s.SoundProvider.TypeKey(), func(id string) []store.Key {
+		sound := &Sound{Id: id}
+		return []store.Key{s.SoundProvider.ObjectKey(sound), s.SoundProvider.FieldKey(sound, "Audio")}
+	})
+	if ok {
+		return ids
+	}
+
+	for _, sound := range s.SoundProvider.List() {
+		ids[sound.Id] = true
+	}
+
+	for id := range s.changes.sounds {
+		ids[id] = true
+	}
+
+	return ids
+}
+
+// changedGroups returns the ids of the groups written in c, every group is compared if a key can not be read.
+func (s *Service) changedGroups(c storage.Change) map[string]bool {
+	ids, ok := changedIds(c, s.GroupProvider.TypeKey(), func(id string) []store.Key {
+		return []store.Key{s.GroupProvider.ObjectKey(&Group{Id: id})}
+	})
+	if ok {
+		return ids
+	}
+
+	for _, group := range s.GroupProvider.List() {
+		ids[group.Id] = true
+	}
+
+	for id := range s.changes.groups {
+		ids[id] = true
+	}
+
+	return ids
+}
+
+// changedIds returns the ids of the objects of typeKey written in c. keys returns the keys an object is stored under,
+// they are the type key followed by the id and a suffix. ok is false if a key does not match one of them.
+func changedIds(c storage.Change, typeKey store.TypeKey, keys func(id string) []store.Key) (ids map[string]bool, ok bool) {
+	ids = map[string]bool{}
+
+	prefix := typeKey.Bytes()
+	templates := keys("")
+
+	for _, key := range c.Keys {
+		if !bytes.HasPrefix(key, prefix) {
+			continue
+		}
+
+		found := false
+		for i := range templates {
+			suffix := bytes.TrimPrefix(templates[i].Bytes(), prefix)
+			if len(key) < len(prefix)+len(suffix) || !bytes.HasSuffix(key, suffix) {
+				continue
+			}
+
+			id := string(key[len(prefix) : len(key)-len(suffix)])
+			if bytes.Equal(keys(id)[i].Bytes(), key) {
+				ids[id], found = true, true
+				break
+			}
+		}
+
+		if !found {
+			return ids, false
+		}
+	}
+
+	return ids, true
+}
+
+// visibleSound copies the sound with id if it is not hidden.
+func (s *Service) visibleSound(id string) (Sound, bool) {
+	sound := s.SoundProvider.Get(id)
+	if sound == nil || sound.Hidden {
+		return Sound{}, false
+	}
+
+	return *sound, true
+}
+
+func (s *Service) group(id string) (Group, bool) {
+	group := s.GroupProvider.Get(id)
+	if group == nil {
+		return Group{}, false
+	}
+
+	g := *group
+	g.SoundIds = append([]string{}, group.SoundIds...)
+
+	return g, true
+}
+
+// visibleSounds copies the sounds that are not hidden, handlers change cached sounds before saving them.
+func (s *Service) visibleSounds() map[string]Sound {
+	sounds := map[string]Sound{}
+
+	for _, sound := range s.SoundProvider.List() {
+		if !sound.Hidden {
+			sounds[sound.Id] = *sound
+		}
+	}
+
+	return sounds
+}
+
+func (s *Service) groups() map[string]Group {
+	groups := map[string]Group{}
+
+	for _, group := range s.GroupProvider.List() {
+		g := *group
+		g.SoundIds = append([]string{}, group.SoundIds...)
+
+		groups[group.Id] = g
+	}
+
+	return groups
+}
+
+func sameSound(a, b Sound) bool {
+	return a.Name == b.Name && a.Duration == b.Duration && a.CreatedAt.Equal(b.CreatedAt)
+}
+
+func sameGroup(a, b Group) bool {
+	if a.Name != b.Name || a.Duration != b.Duration || len(a.SoundIds) != len(b.SoundIds) {
+		return false
+	}
+
+	for i := range a.SoundIds {
+		if a.SoundIds[i] != b.SoundIds[i] {
+			return false
+		}
+	}
+
+	return true
+}
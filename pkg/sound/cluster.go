@@ -0,0 +1,188 @@
+package sound
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	"sync"
+)
+
+const (
+	// replicas send queue commands to the leader on this channel
+	queueChannel = "speakerbob.queue"
+
+	// the leader publishes its queue on this channel after every change
+	queueStateChannel = "speakerbob.queue.state"
+)
+
+type queueOperation string
+
+const (
+	enqueueOperation queueOperation = "enqueue"
+	clearOperation   queueOperation = "clear"
+	reportOperation  queueOperation = "report"
+)
+
+// queueCommand changes the queue of the leader.
+type queueCommand struct {
+	Operation    queueOperation `json:"operation"`
+	Sounds       []Sound        `json:"sounds,omitempty"`
+	ConnectionId string         `json:"connection_id,omitempty"`
+	PlayId       string         `json:"play_id,omitempty"`
+	Status       PlaybackStatus `json:"status,omitempty"`
+	Guest        bool           `json:"guest,omitempty"`
+}
+
+// queueState is the queue of the leader, the other replicas serve it to their clients.
+type queueState struct {
+	m sync.RWMutex
+
+	Sounds []Sound     `json:"sounds"`
+	Plays  []PlayStats `json:"plays"`
+}
+
+// leader returns true if this replica plays the queue.
+func (s *Service) leader() bool {
+	return s.Cluster == nil || s.Cluster.Elector.Leader()
+}
+
+func (s *Service) enqueue(sounds ...Sound) {
+	if s.Cluster == nil {
+		s.playQueue.EnqueueSounds(sounds...)
+		return
+	}
+
+	s.sendQueueCommand(queueCommand{Operation: enqueueOperation, Sounds: sounds})
+}
+
+func (s *Service) clearQueue() {
+	if s.Cluster == nil {
+		s.playQueue.Clear()
+		return
+	}
+
+	s.sendQueueCommand(queueCommand{Operation: clearOperation})
+}
+
+func (s *Service) report(connectionId string, playId string, status PlaybackStatus, guest bool) {
+	if s.Cluster == nil {
+		s.playQueue.Report(connectionId, playId, status, guest)
+		return
+	}
+
+	s.sendQueueCommand(queueCommand{
+		Operation:    reportOperation,
+		ConnectionId: connectionId,
+		PlayId:       playId,
+		Status:       status,
+		Guest:        guest,
+	})
+}
+
+// queued returns the sounds waiting to be played on the leader.
+func (s *Service) queued() []Sound {
+	if s.leader() {
+		return s.playQueue.List()
+	}
+
+	s.queueState.m.RLock()
+	defer s.queueState.m.RUnlock()
+
+	return append(make([]Sound, 0, len(s.queueState.Sounds)), s.queueState.Sounds...)
+}
+
+// plays returns the delivery stats of the most recent plays on the leader.
+func (s *Service) plays() []PlayStats {
+	if s.leader() {
+		return s.playQueue.Plays()
+	}
+
+	s.queueState.m.RLock()
+	defer s.queueState.m.RUnlock()
+
+	return append(make([]PlayStats, 0, len(s.queueState.Plays)), s.queueState.Plays...)
+}
+
+// runCluster receives queue commands and states from the other replicas and plays the queue while this replica is
+// the leader. Commands sent while no replica is the leader are lost.
+func (s *Service) runCluster(ctx context.Context) {
+	if err := s.Cluster.PubSub.Subscribe(ctx, queueChannel, s.applyQueueCommand); err != nil {
+		logrus.Errorf("[sound.runCluster] unable to receive queue commands: %v", err)
+	}
+
+	if err := s.Cluster.PubSub.Subscribe(ctx, queueStateChannel, s.receiveQueueState); err != nil {
+		logrus.Errorf("[sound.runCluster] unable to receive the queue: %v", err)
+	}
+
+	s.Cluster.Elector.Lead(ctx, func(ctx context.Context) {
+		s.queueState.m.RLock()
+		sounds := s.queueState.Sounds
+		s.queueState.m.RUnlock()
+
+		s.playQueue.restore(sounds)
+		s.playQueue.ConsumeQueue(ctx, s.WebsocketService)
+	})
+}
+
+func (s *Service) sendQueueCommand(command queueCommand) {
+	data, err := json.Marshal(command)
+	if err == nil {
+		err = s.Cluster.PubSub.Publish(queueChannel, data)
+	}
+
+	if err != nil {
+		logrus.Errorf("[sound.sendQueueCommand] unable to send %s to the leader: %v", command.Operation, err)
+	}
+}
+
+func (s *Service) applyQueueCommand(data []byte) {
+	var command queueCommand
+
+	if !s.Cluster.Elector.Leader() {
+		return
+	}
+
+	if err := json.Unmarshal(data, &command); err != nil {
+		logrus.Errorf("[sound.applyQueueCommand] invalid command: %v", err)
+		return
+	}
+
+	switch command.Operation {
+	case enqueueOperation:
+		s.playQueue.EnqueueSounds(command.Sounds...)
+	case clearOperation:
+		s.playQueue.Clear()
+	case reportOperation:
+		s.playQueue.Report(command.ConnectionId, command.PlayId, command.Status, command.Guest)
+	}
+}
+
+// publishQueueState sends the queue of the leader to every replica.
+func (s *Service) publishQueueState() {
+	if !s.Cluster.Elector.Leader() {
+		return
+	}
+
+	data, err := json.Marshal(&queueState{Sounds: s.playQueue.List(), Plays: s.playQueue.Plays()})
+	if err == nil {
+		err = s.Cluster.PubSub.Publish(queueStateChannel, data)
+	}
+
+	if err != nil {
+		logrus.Errorf("[sound.publishQueueState] unable to publish the queue: %v", err)
+	}
+}
+
+func (s *Service) receiveQueueState(data []byte) {
+	var state queueState
+
+	if err := json.Unmarshal(data, &state); err != nil {
+		logrus.Errorf("[sound.receiveQueueState] invalid queue: %v", err)
+		return
+	}
+
+	s.queueState.m.Lock()
+	s.queueState.Sounds = state.Sounds
+	s.queueState.Plays = state.Plays
+	s.queueState.m.Unlock()
+}
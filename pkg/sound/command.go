@@ -0,0 +1,130 @@
+package sound
+
+import (
+	"encoding/json"
+	"github.com/paynejacob/speakerbob/pkg/auth"
+	"github.com/paynejacob/speakerbob/pkg/service"
+	"github.com/paynejacob/speakerbob/pkg/websocket"
+)
+
+type playSoundCommand struct {
+	SoundId string `json:"sound_id"`
+}
+
+type playGroupCommand struct {
+	GroupId string `json:"group_id"`
+}
+
+type sayCommand struct {
+	Text string `json:"text"`
+}
+
+type playbackCommand struct {
+	PlayId string         `json:"play_id"`
+	Status PlaybackStatus `json:"status"`
+}
+
+func (s *Service) registerCommands() {
+	s.WebsocketService.RegisterCommand(websocket.PlaySoundCommandType, auth.PlayPermission, s.playSoundCommand)
+	s.WebsocketService.RegisterCommand(websocket.PlayGroupCommandType, auth.PlayPermission, s.playGroupCommand)
+	s.WebsocketService.RegisterCommand(websocket.SayCommandType, auth.SayPermission, s.sayCommand)
+	s.WebsocketService.RegisterCommand(websocket.QueueCommandType, auth.ListenPermission, s.queueCommand)
+	s.WebsocketService.RegisterCommand(websocket.ClearQueueCommandType, auth.EditPermission, s.clearQueueCommand)
+	s.WebsocketService.RegisterCommand(websocket.PlaybackCommandType, auth.ListenPermission, s.playbackCommand)
+}
+
+func (s *Service) playSoundCommand(_ *websocket.Conn, body json.RawMessage) (interface{}, error) {
+	var request playSoundCommand
+
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, service.NewNotAcceptableError("unable to parse request")
+	}
+
+	sound := s.SoundProvider.Get(request.SoundId)
+	if sound == nil {
+		return nil, service.NewNotAcceptableError("invalid sound id: " + request.SoundId)
+	}
+
+	s.enqueue(*sound)
+
+	return nil, nil
+}
+
+func (s *Service) playGroupCommand(_ *websocket.Conn, body json.RawMessage) (interface{}, error) {
+	var request playGroupCommand
+
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, service.NewNotAcceptableError("unable to parse request")
+	}
+
+	group := s.GroupProvider.Get(request.GroupId)
+	if group == nil {
+		return nil, service.NewNotAcceptableError("invalid group id: " + request.GroupId)
+	}
+
+	sounds := make([]Sound, 0, len(group.SoundIds))
+	for i := range group.SoundIds {
+		sound := s.SoundProvider.Get(group.SoundIds[i])
+		if sound == nil {
+			return nil, service.NewNotAcceptableError("invalid sound id: " + group.SoundIds[i])
+		}
+
+		sounds = append(sounds, *sound)
+	}
+
+	s.enqueue(sounds...)
+
+	return nil, nil
+}
+
+func (s *Service) sayCommand(_ *websocket.Conn, body json.RawMessage) (interface{}, error) {
+	var request sayCommand
+
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, service.NewNotAcceptableError("unable to parse request")
+	}
+
+	sound, err := s.SoundProvider.NewTTSSound(request.Text, s.MaxSoundDuration)
+	if err != nil {
+		return nil, err
+	}
+
+	s.enqueue(*sound)
+
+	return nil, nil
+}
+
+func (s *Service) queueCommand(*websocket.Conn, json.RawMessage) (interface{}, error) {
+	return s.queued(), nil
+}
+
+func (s *Service) clearQueueCommand(*websocket.Conn, json.RawMessage) (interface{}, error) {
+	s.clearQueue()
+
+	return nil, nil
+}
+
+func (s *Service) playbackCommand(conn *websocket.Conn, body json.RawMessage) (interface{}, error) {
+	var request playbackCommand
+
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, service.NewNotAcceptableError("unable to parse request")
+	}
+
+	switch request.Status {
+	case StartedPlaybackStatus, FinishedPlaybackStatus, FailedPlaybackStatus:
+	default:
+		return nil, service.NewNotAcceptableError("invalid status: " + string(request.Status))
+	}
+
+	s.report(conn.Presence().Id, request.PlayId, request.Status, s.guest(conn))
+
+	return nil, nil
+}
+
+// guest returns true if conn did not authenticate while authentication is enabled.
+func (s *Service) guest(conn *websocket.Conn) bool {
+	authService := s.WebsocketService.AuthService
+
+	return conn.Token() == nil && authService != nil && authService.Enabled()
+}
@@ -0,0 +1,91 @@
+package sound
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"time"
+)
+
+// hijackedResponse writes a response to a hijacked connection, exports and imports can take longer than the http
+// server's read and write timeouts.
+type hijackedResponse struct {
+	conn        net.Conn
+	w           *bufio.Writer
+	header      http.Header
+	wroteHeader bool
+}
+
+// hijack takes over the connection of r when possible and clears its deadlines. The returned writer and body replace
+// w and r.Body, close must be called once the response is written.
+func hijack(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, io.Reader, func() error, error) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return w, r.Body, func() error { return nil }, nil
+	}
+
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+
+	// headers set by middleware, like cors, are kept. The response is written around the compress middleware so its
+	// encoding is dropped.
+	resp := &hijackedResponse{conn: conn, w: buf.Writer, header: w.Header().Clone()}
+	resp.header.Del("Content-Encoding")
+	resp.header.Del("Content-Length")
+
+	// the server only answers expect headers when the body is read through the request
+	if strings.EqualFold(r.Header.Get("Expect"), "100-continue") {
+		_, _ = buf.WriteString("HTTP/1.1 100 Continue\r\n\r\n")
+		if err = buf.Flush(); err != nil {
+			_ = conn.Close()
+			return nil, nil, nil, err
+		}
+	}
+
+	var body io.Reader = io.LimitReader(buf.Reader, r.ContentLength)
+	if r.ContentLength < 0 {
+		body = httputil.NewChunkedReader(buf.Reader)
+	}
+
+	return resp, body, resp.close, nil
+}
+
+func (h *hijackedResponse) Header() http.Header {
+	return h.header
+}
+
+func (h *hijackedResponse) WriteHeader(statusCode int) {
+	if h.wroteHeader {
+		return
+	}
+	h.wroteHeader = true
+
+	h.header.Set("Connection", "close")
+
+	_, _ = fmt.Fprintf(h.w, "HTTP/1.1 %d %s\r\n", statusCode, http.StatusText(statusCode))
+	_ = h.header.Write(h.w)
+	_, _ = h.w.WriteString("\r\n")
+}
+
+func (h *hijackedResponse) Write(p []byte) (int, error) {
+	h.WriteHeader(http.StatusOK)
+
+	return h.w.Write(p)
+}
+
+func (h *hijackedResponse) close() error {
+	h.WriteHeader(http.StatusOK)
+
+	err := h.w.Flush()
+	_ = h.conn.Close()
+
+	return err
+}
@@ -5,18 +5,52 @@ import (
 	"time"
 )
 
+// PlayMessage tells clients to start playing a sound at the scheduled time. Clients add the clock offset, in
+// milliseconds, to the scheduled time to get the start time on their own clock. Clients report their playback with
+// the play id.
 type PlayMessage struct {
-	Type      websocket.MessageType `json:"type"`
-	Sound     Sound                 `json:"sound"`
-	Scheduled time.Time             `json:"scheduled"`
+	Type        websocket.MessageType `json:"type"`
+	PlayId      string                `json:"play_id"`
+	Sound       Sound                 `json:"sound"`
+	Scheduled   time.Time             `json:"scheduled"`
+	ClockOffset int64                 `json:"clock_offset"`
 }
 
+func (m PlayMessage) MessageType() websocket.MessageType { return m.Type }
+
+func (m PlayMessage) WithClockOffset(offset time.Duration) interface{} {
+	m.ClockOffset = int64(offset / time.Millisecond)
+
+	return m
+}
+
+func (m PlayMessage) AudioId() string { return m.Sound.Id }
+
 type SoundMessage struct {
 	Type  websocket.MessageType `json:"type"`
 	Sound *Sound                `json:"sound"`
 }
 
+func (m SoundMessage) MessageType() websocket.MessageType { return m.Type }
+
 type GroupMessage struct {
 	Type  websocket.MessageType `json:"type"`
 	Group *Group                `json:"group"`
 }
+
+func (m GroupMessage) MessageType() websocket.MessageType { return m.Type }
+
+// registerMessages lets the websocket service decode the messages other replicas broadcast.
+func (s *Service) registerMessages() {
+	newPlayMessage := func() websocket.Message { return &PlayMessage{} }
+	newSoundMessage := func() websocket.Message { return &SoundMessage{} }
+	newGroupMessage := func() websocket.Message { return &GroupMessage{} }
+
+	s.WebsocketService.RegisterMessage(websocket.PlayMessageType, newPlayMessage)
+	s.WebsocketService.RegisterMessage(websocket.CreateSoundMessageType, newSoundMessage)
+	s.WebsocketService.RegisterMessage(websocket.UpdateSoundMessageType, newSoundMessage)
+	s.WebsocketService.RegisterMessage(websocket.DeleteSoundMessageType, newSoundMessage)
+	s.WebsocketService.RegisterMessage(websocket.CreateGroupMessageType, newGroupMessage)
+	s.WebsocketService.RegisterMessage(websocket.UpdateGroupMessageType, newGroupMessage)
+	s.WebsocketService.RegisterMessage(websocket.DeleteGroupMessageType, newGroupMessage)
+}
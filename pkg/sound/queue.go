@@ -2,17 +2,66 @@ package sound
 
 import (
 	"context"
+	"github.com/google/uuid"
 	"github.com/paynejacob/speakerbob/pkg/websocket"
+	"strings"
 	"sync"
 	"time"
 )
 
+const (
+	// time added to a sound's duration before the queue moves on without a client reporting it finished
+	playGracePeriod = time.Second
+
+	// time to wait for a sound with an unknown duration when max duration is not configured
+	defaultPlayTimeout = 30 * time.Second
+
+	// number of plays kept for delivery stats
+	playHistorySize = 32
+)
+
+type PlaybackStatus string
+
+const (
+	StartedPlaybackStatus  PlaybackStatus = "started"
+	FinishedPlaybackStatus PlaybackStatus = "finished"
+	FailedPlaybackStatus   PlaybackStatus = "failed"
+)
+
+// PlayStats counts how many clients played a sound. Each connection is counted once per status.
+type PlayStats struct {
+	PlayId    string    `json:"play_id"`
+	SoundId   string    `json:"sound_id"`
+	Scheduled time.Time `json:"scheduled"`
+	Listeners int       `json:"listeners"`
+	Started   int       `json:"started"`
+	Finished  int       `json:"finished"`
+	Failed    int       `json:"failed"`
+	TimedOut  bool      `json:"timed_out"`
+
+	reports map[string]map[PlaybackStatus]bool
+
+	// skipped is set once a connection that is not a guest reports the play finished
+	skipped bool
+}
+
 type playQueue struct {
 	m sync.RWMutex
 
-	playChannel chan bool
+	playChannel     chan bool
+	finishedChannel chan string
+
+	// sounds are scheduled this far in the future so every client can start them at the same time
+	leadTime time.Duration
+
+	// how long to wait for sounds with an unknown duration
+	maxDuration time.Duration
 
 	sounds []Sound
+	plays  []*PlayStats
+
+	// changed is called after the queue or the play stats change
+	changed func()
 }
 
 func (q *playQueue) EnqueueSounds(sounds ...Sound) {
@@ -22,78 +71,231 @@ func (q *playQueue) EnqueueSounds(sounds ...Sound) {
 		q.sounds = append(q.sounds, sounds[i])
 	}
 
-	q.playChannel <- true
+	// the consumer is already signaled if the channel is full
+	select {
+	case q.playChannel <- true:
+	default:
+	}
+
+	q.m.Unlock()
+
+	q.notify()
+}
 
+// restore replaces the queued sounds, a replica that becomes the leader continues the queue of the previous leader.
+func (q *playQueue) restore(sounds []Sound) {
+	q.m.Lock()
+	q.sounds = append(make([]Sound, 0, len(sounds)), sounds...)
 	q.m.Unlock()
+
+	if len(sounds) > 0 {
+		select {
+		case q.playChannel <- true:
+		default:
+		}
+	}
 }
 
+func (q *playQueue) notify() {
+	if q.changed != nil {
+		q.changed()
+	}
+}
+
+// ConsumeQueue plays the queued sounds in order. The next sound is played when the first client that is not a guest
+// reports the current sound finished, or when the sound should have finished if no client reports it.
 func (q *playQueue) ConsumeQueue(ctx context.Context, ws *websocket.Service) {
-	var timer *time.Timer
-	var isEmpty bool
-	var isPlaying bool
-	var _sound Sound
+	var current *PlayStats
 
-	timer = time.NewTimer(0)
+	timer := time.NewTimer(0)
+	stopTimer(timer)
 
 	for {
 		select {
 		case <-ctx.Done():
-			break
+			return
 		case <-q.playChannel:
 			// if something is already playing we do nothing
-			if isPlaying {
+			if current != nil {
 				continue
 			}
 
-			// get the next sound off the playQueue and play it
-			_sound, _ = q.pop()
-			ws.BroadcastMessage(PlayMessage{
-				Type:      websocket.PlayMessageType,
-				Sound:     _sound,
-				Scheduled: time.Now(),
-			})
-			isPlaying = true
-			timer.Reset(_sound.Duration) // set a timer for the duration of the sound
+			current = q.playNext(ws, timer)
 		case <-timer.C:
-			// the sound finished playing
-			isPlaying = false
+			// no client reported the sound finished
+			q.m.Lock()
+			current.TimedOut = true
+			q.m.Unlock()
+			q.notify()
 
-			// play the next sound, if there is no next sound exit
-			_sound, isEmpty = q.pop()
-			if isEmpty {
+			current = q.playNext(ws, timer)
+		case playId := <-q.finishedChannel:
+			if current == nil || current.PlayId != playId {
 				continue
 			}
 
-			ws.BroadcastMessage(PlayMessage{
-				Type:      websocket.PlayMessageType,
-				Sound:     _sound,
-				Scheduled: time.Now(),
-			})
-			isPlaying = true
-			timer.Reset(_sound.Duration) // set a timer for the duration of the sound
+			stopTimer(timer)
+			current = q.playNext(ws, timer)
 		}
 	}
 }
 
-func (q *playQueue) empty() bool {
-	q.m.RLock()
-	defer q.m.RUnlock()
+// playNext broadcasts the next sound and starts its timeout, nil is returned if the queue is empty.
+func (q *playQueue) playNext(ws *websocket.Service, timer *time.Timer) *PlayStats {
+	sound, isEmpty := q.pop()
+	if isEmpty {
+		return nil
+	}
+
+	play := &PlayStats{
+		PlayId:    strings.Replace(uuid.New().String(), "-", "", 4),
+		SoundId:   sound.Id,
+		Scheduled: time.Now().Add(q.leadTime),
+		Listeners: ws.ConnectionCount(),
+		reports:   map[string]map[PlaybackStatus]bool{},
+	}
 
-	return len(q.sounds) == 0
+	q.m.Lock()
+	q.plays = append(q.plays, play)
+	if len(q.plays) > playHistorySize {
+		q.plays = q.plays[1:]
+	}
+	q.m.Unlock()
+
+	ws.BroadcastMessage(PlayMessage{
+		Type:      websocket.PlayMessageType,
+		PlayId:    play.PlayId,
+		Sound:     sound,
+		Scheduled: play.Scheduled,
+	})
+
+	timer.Reset(q.leadTime + q.timeout(sound))
+
+	q.notify()
+
+	return play
 }
 
-func (q *playQueue) pop() (s Sound, empty bool) {
-	empty = q.empty()
+// timeout is how long to wait for a client to report the sound finished.
+func (q *playQueue) timeout(sound Sound) time.Duration {
+	if sound.Duration > 0 {
+		return sound.Duration + playGracePeriod
+	}
+
+	if q.maxDuration > 0 {
+		return q.maxDuration + playGracePeriod
+	}
+
+	return defaultPlayTimeout
+}
+
+// Report records the playback status a connection reported for a play. Reports for unknown plays are ignored.
+// Guests are counted but can not skip to the next sound by reporting the play finished early.
+func (q *playQueue) Report(connectionId string, playId string, status PlaybackStatus, guest bool) {
+	var finished bool
+	var counted bool
 
-	if empty {
-		return
+	q.m.Lock()
+
+	for i := range q.plays {
+		play := q.plays[i]
+
+		if play.PlayId != playId {
+			continue
+		}
+
+		if play.reports[connectionId] == nil {
+			play.reports[connectionId] = map[PlaybackStatus]bool{}
+		}
+
+		if play.reports[connectionId][status] {
+			break
+		}
+		play.reports[connectionId][status] = true
+		counted = true
+
+		switch status {
+		case StartedPlaybackStatus:
+			play.Started++
+		case FinishedPlaybackStatus:
+			play.Finished++
+			finished = !guest && !play.skipped
+			play.skipped = play.skipped || finished
+		case FailedPlaybackStatus:
+			play.Failed++
+		}
+
+		break
 	}
 
+	q.m.Unlock()
+
+	if counted {
+		q.notify()
+	}
+
+	if finished {
+		select {
+		case q.finishedChannel <- playId:
+		default:
+		}
+	}
+}
+
+// Plays returns the delivery stats of the most recent plays.
+func (q *playQueue) Plays() []PlayStats {
 	q.m.RLock()
 	defer q.m.RUnlock()
 
+	plays := make([]PlayStats, len(q.plays))
+	for i := range q.plays {
+		plays[i] = *q.plays[i]
+		plays[i].reports = nil
+	}
+
+	return plays
+}
+
+// List returns the sounds waiting to be played.
+func (q *playQueue) List() []Sound {
+	q.m.RLock()
+	defer q.m.RUnlock()
+
+	sounds := make([]Sound, len(q.sounds))
+	copy(sounds, q.sounds)
+
+	return sounds
+}
+
+// Clear removes all sounds waiting to be played.
+func (q *playQueue) Clear() {
+	q.m.Lock()
+	q.sounds = make([]Sound, 0)
+	q.m.Unlock()
+
+	q.notify()
+}
+
+func (q *playQueue) pop() (s Sound, empty bool) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	if len(q.sounds) == 0 {
+		return s, true
+	}
+
 	s = q.sounds[0]
 	q.sounds = q.sounds[1:]
 
 	return
 }
+
+// stopTimer stops the timer and drains its channel so it can be reset.
+func stopTimer(timer *time.Timer) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+}
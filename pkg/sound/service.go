@@ -1,13 +1,20 @@
 package sound
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/gorilla/mux"
+	"github.com/paynejacob/speakerbob/pkg/cluster"
 	"github.com/paynejacob/speakerbob/pkg/service"
+	"github.com/paynejacob/speakerbob/pkg/storage"
 	"github.com/paynejacob/speakerbob/pkg/websocket"
 	"github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"os"
 	"sync"
 	"time"
 )
@@ -17,12 +24,22 @@ type Service struct {
 	GroupProvider    *GroupProvider
 	WebsocketService *websocket.Service
 	MaxSoundDuration time.Duration
+	PlayLeadTime     time.Duration
 
-	playQueue playQueue
+	// Cluster shares the queue between replicas, the leader plays it. The queue is local if it is nil.
+	Cluster *cluster.Cluster
+
+	// Feed tells clients about every sound and group written to the store, clients are not told if it is nil.
+	Feed storage.Feed
+
+	playQueue  playQueue
+	queueState queueState
+	changes    changes
 }
 
 const cleanupInterval = 4 * time.Hour
 const hiddenSoundTTL = 24 * time.Hour
+const maxImportSize = 1 << 30
 
 func (s *Service) RegisterRoutes(router *mux.Router) {
 	r := router.PathPrefix("/sound").Subrouter()
@@ -36,6 +53,11 @@ func (s *Service) RegisterRoutes(router *mux.Router) {
 	sounds.HandleFunc("/{soundId}/play/", s.playSound).Methods(http.MethodPut)
 	sounds.HandleFunc("/{soundId}/download/", s.downloadSound).Methods(http.MethodGet)
 
+	r.HandleFunc("/queue/", s.listQueue).Methods(http.MethodGet)
+	r.HandleFunc("/plays/", s.listPlays).Methods(http.MethodGet)
+	r.HandleFunc("/export/", s.exportSounds).Methods(http.MethodGet)
+	r.HandleFunc("/import/", s.importSounds).Methods(http.MethodPost)
+
 	groups := r.PathPrefix("/groups").Subrouter()
 	groups.HandleFunc("/", s.listGroup).Methods(http.MethodGet)
 	groups.HandleFunc("/", s.createGroup).Methods(http.MethodPost)
@@ -46,6 +68,9 @@ func (s *Service) RegisterRoutes(router *mux.Router) {
 	r.HandleFunc("/search/", s.search).Methods(http.MethodGet)
 	r.HandleFunc("/say/", s.say).Methods(http.MethodPut)
 
+	s.registerCommands()
+	s.registerMessages()
+	s.WebsocketService.RegisterAudioSource(s.readAudio)
 }
 
 func (s *Service) Run(ctx context.Context) {
@@ -54,12 +79,26 @@ func (s *Service) Run(ctx context.Context) {
 	var ticker *time.Ticker
 
 	s.playQueue = playQueue{
-		m:           sync.RWMutex{},
-		playChannel: make(chan bool, 0),
-		sounds:      make([]Sound, 0),
+		m:               sync.RWMutex{},
+		playChannel:     make(chan bool, 1),
+		finishedChannel: make(chan string, 1),
+		leadTime:        s.PlayLeadTime,
+		maxDuration:     s.MaxSoundDuration,
+		sounds:          make([]Sound, 0),
+	}
+
+	if s.Cluster != nil {
+		s.playQueue.changed = s.publishQueueState
+		go s.runCluster(ctx)
+	} else {
+		go s.playQueue.ConsumeQueue(ctx, s.WebsocketService)
 	}
 
-	go s.playQueue.ConsumeQueue(ctx, s.WebsocketService)
+	if s.Feed != nil {
+		s.watch(ctx)
+	}
+
+	go s.moveAudio()
 
 	ticker = time.NewTicker(cleanupInterval)
 
@@ -69,13 +108,18 @@ func (s *Service) Run(ctx context.Context) {
 		case <-ctx.Done():
 			break
 		case <-ticker.C:
+			// the replicas share their sounds
+			if !s.leader() {
+				continue
+			}
+
 			logrus.Debug("starting hidden sound cleanup")
 			now = time.Now()
 
 			for _, sound := range s.SoundProvider.List() {
 				if sound.Hidden && now.Sub(sound.CreatedAt) > hiddenSoundTTL {
 					logrus.Infof("deleting \"%s\" expired hidden sounds", sound.Id)
-					err = s.SoundProvider.Delete(sound)
+					err = DeleteSoundWithGroups(s.GroupProvider, s.SoundProvider, sound)
 					if err != nil {
 						logrus.Errorf("error deleting hidden sound: %d", err)
 					}
@@ -177,11 +221,6 @@ func (s *Service) updateSound(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.WebsocketService.BroadcastMessage(SoundMessage{
-		Type:  websocket.UpdateSoundMessageType,
-		Sound: sound,
-	})
-
 	w.WriteHeader(http.StatusAccepted)
 }
 
@@ -200,11 +239,6 @@ func (s *Service) deleteSound(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.WebsocketService.BroadcastMessage(SoundMessage{
-		Type:  websocket.DeleteSoundMessageType,
-		Sound: sound,
-	})
-
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -215,13 +249,14 @@ func (s *Service) playSound(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.playQueue.EnqueueSounds(*_sound)
+	s.enqueue(*_sound)
 
 	w.WriteHeader(http.StatusAccepted)
 }
 
 func (s *Service) downloadSound(w http.ResponseWriter, r *http.Request) {
 	var sound *Sound
+	var audio io.ReadSeekCloser
 	var err error
 
 	sound = s.SoundProvider.Get(mux.Vars(r)["soundId"])
@@ -230,15 +265,128 @@ func (s *Service) downloadSound(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// serve range requests without reading the whole sound when the store supports it
+	if opener, ok := s.SoundProvider.Store.(lazyOpener); ok {
+		audio, err = opener.OpenLazy(s.SoundProvider.FieldKey(sound, "Audio"))
+	} else {
+		var buf bytes.Buffer
+
+		err = s.SoundProvider.ReadAudio(sound, &buf)
+		audio = nopCloser{bytes.NewReader(buf.Bytes())}
+	}
+	if err != nil {
+		service.WriteErrorResponse(w, err)
+		return
+	}
+	defer audio.Close()
+
 	w.Header().Set("Content-Type", "audio/mpeg")
 	w.Header().Set("Cache-Control", "max-age=31536000")
 
-	err = s.SoundProvider.ReadAudio(sound, w)
+	http.ServeContent(w, r, sound.Id+".mp3", sound.CreatedAt, audio)
+}
+
+// moveAudio moves audio written before blob storage existed to the blob store.
+func (s *Service) moveAudio() {
+	var count int
+
+	mover, ok := s.SoundProvider.Store.(lazyMover)
+	if !ok {
+		return
+	}
+
+	for _, sound := range s.SoundProvider.List() {
+		moved, err := mover.MoveLazy(s.SoundProvider.FieldKey(sound, "Audio"))
+		if err != nil {
+			logrus.Errorf("[sound.moveAudio] failed to move audio for %s: %v", sound.Id, err)
+			continue
+		}
+
+		if moved {
+			count++
+		}
+	}
+
+	if count > 0 {
+		logrus.Infof("moved the audio of %d sounds to blob storage", count)
+	}
+}
+
+// readAudio streams the audio for played sounds to websocket clients.
+func (s *Service) readAudio(id string, w io.Writer) error {
+	sound := s.SoundProvider.Get(id)
+	if sound == nil {
+		return fmt.Errorf("invalid sound id: %s", id)
+	}
+
+	return s.SoundProvider.ReadAudio(sound, w)
+}
+
+// listQueue returns the sounds waiting to be played.
+func (s *Service) listQueue(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.queued())
+}
+
+// listPlays returns how many clients played each of the most recent sounds.
+func (s *Service) listPlays(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.plays())
+}
+
+func (s *Service) exportSounds(w http.ResponseWriter, r *http.Request) {
+	resp, _, closeResponse, err := hijack(w, r)
 	if err != nil {
-		service.WriteErrorResponse(w, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = closeResponse() }()
+
+	resp.Header().Set("Content-Type", "application/zip")
+	resp.Header().Set("Content-Disposition", "attachment; filename=\"speakerbob-sounds.zip\"")
+
+	if _, err = Export(resp, s.SoundProvider, s.GroupProvider); err != nil {
+		// the response has started, the client sees a truncated zip
+		logrus.Errorf("[sound.exportSounds] failed to write export: %v", err)
 	}
 }
 
+func (s *Service) importSounds(w http.ResponseWriter, r *http.Request) {
+	resp, body, closeResponse, err := hijack(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = closeResponse() }()
+
+	// zips are read from the end, stage the upload
+	f, err := ioutil.TempFile("", "speakerbob-import-*")
+	if err != nil {
+		service.WriteErrorResponse(resp, err)
+		return
+	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+
+	size, err := io.Copy(f, http.MaxBytesReader(resp, ioutil.NopCloser(body), maxImportSize))
+	if err != nil {
+		service.WriteErrorResponse(resp, service.NewNotAcceptableError("unable to read import"))
+		return
+	}
+
+	result, err := Import(f, size, s.SoundProvider, s.GroupProvider, s.MaxSoundDuration)
+	if err != nil {
+		service.WriteErrorResponse(resp, err)
+		return
+	}
+
+	resp.Header().Set("Content-Type", "application/json")
+	resp.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(resp).Encode(result)
+}
+
 func (s *Service) listGroup(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Add("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(s.GroupProvider.List())
@@ -295,11 +443,6 @@ func (s *Service) createGroup(w http.ResponseWriter, r *http.Request) {
 		service.WriteErrorResponse(w, err)
 		return
 	}
-
-	s.WebsocketService.BroadcastMessage(GroupMessage{
-		Type:  websocket.CreateGroupMessageType,
-		Group: &group,
-	})
 }
 
 func (s *Service) updateGroup(w http.ResponseWriter, r *http.Request) {
@@ -352,11 +495,6 @@ func (s *Service) updateGroup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.WriteHeader(http.StatusAccepted)
-
-	s.WebsocketService.BroadcastMessage(GroupMessage{
-		Type:  websocket.UpdateGroupMessageType,
-		Group: group,
-	})
 }
 
 func (s *Service) deleteGroup(w http.ResponseWriter, r *http.Request) {
@@ -374,13 +512,6 @@ func (s *Service) deleteGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if group != nil {
-		s.WebsocketService.BroadcastMessage(GroupMessage{
-			Type:  websocket.DeleteGroupMessageType,
-			Group: group,
-		})
-	}
-
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -396,7 +527,7 @@ func (s *Service) playGroup(w http.ResponseWriter, r *http.Request) {
 		sounds[i] = *s.SoundProvider.Get(group.SoundIds[i])
 	}
 
-	s.playQueue.EnqueueSounds(sounds...)
+	s.enqueue(sounds...)
 
 	w.WriteHeader(http.StatusAccepted)
 }
@@ -439,7 +570,7 @@ func (s *Service) say(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// enqueue playback
-	s.playQueue.EnqueueSounds(*sound)
+	s.enqueue(*sound)
 
 	w.WriteHeader(http.StatusAccepted)
 }
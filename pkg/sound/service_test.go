@@ -2,14 +2,22 @@ package sound
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
 	"fmt"
 	"github.com/gavv/httpexpect/v2"
 	"github.com/gorilla/mux"
+	gorilla "github.com/gorilla/websocket"
 	"github.com/paynejacob/hotcereal/pkg/stores/memory"
+	"github.com/paynejacob/speakerbob/pkg/auth"
+	"github.com/paynejacob/speakerbob/pkg/cluster"
+	"github.com/paynejacob/speakerbob/pkg/storage"
 	"github.com/paynejacob/speakerbob/pkg/websocket"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -350,6 +358,15 @@ func TestDownloadSound(t *testing.T) {
 		ContentType("audio/mpeg").
 		Body().
 		Equal(string(audioContent))
+
+	// range
+	httpexpect.New(t, sut.URL).
+		GET(fmt.Sprintf("/sound/sounds/%s/download/", s1.Id)).
+		WithHeader("Range", "bytes=1-").
+		Expect().
+		Status(http.StatusPartialContent).
+		Body().
+		Equal(string(audioContent[1:]))
 }
 
 func TestListGroup(t *testing.T) {
@@ -715,3 +732,395 @@ func TestSearch(t *testing.T) {
 		ValueEqual("groups", []Group{})
 
 }
+
+func TestPlayback(t *testing.T) {
+	setup()
+
+	sut := newServer()
+	defer sut.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	svc.playQueue = playQueue{
+		playChannel:     make(chan bool, 1),
+		finishedChannel: make(chan string, 1),
+		maxDuration:     maxDuration,
+		sounds:          make([]Sound, 0),
+	}
+	go svc.playQueue.ConsumeQueue(ctx, &websocketService)
+
+	// the sounds have no duration so the queue waits for a client to finish them
+	s1 := NewSound()
+	s2 := NewSound()
+	svc.playQueue.EnqueueSounds(s1, s2)
+
+	assert.Eventually(t, func() bool { return len(svc.playQueue.Plays()) == 1 }, time.Second, 10*time.Millisecond)
+	playId := svc.playQueue.Plays()[0].PlayId
+
+	svc.playQueue.Report("c1", playId, StartedPlaybackStatus, false)
+	svc.playQueue.Report("c2", playId, StartedPlaybackStatus, false)
+	svc.playQueue.Report("c2", playId, StartedPlaybackStatus, false)
+	svc.playQueue.Report("c1", playId, FailedPlaybackStatus, false)
+
+	// guests can not skip the sound
+	svc.playQueue.Report("guest", playId, FinishedPlaybackStatus, true)
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, svc.playQueue.Plays(), 1)
+
+	svc.playQueue.Report("c2", playId, FinishedPlaybackStatus, false)
+
+	assert.Eventually(t, func() bool { return len(svc.playQueue.Plays()) == 2 }, time.Second, 10*time.Millisecond)
+
+	plays := httpexpect.New(t, sut.URL).
+		GET("/sound/plays/").
+		Expect().
+		Status(http.StatusOK).
+		JSON().Array()
+
+	plays.Length().Equal(2)
+	plays.Element(0).Object().ValueEqual("play_id", playId)
+	plays.Element(0).Object().ValueEqual("sound_id", s1.Id)
+	plays.Element(0).Object().ValueEqual("started", 2)
+	plays.Element(0).Object().ValueEqual("finished", 2)
+	plays.Element(0).Object().ValueEqual("failed", 1)
+	plays.Element(0).Object().ValueEqual("timed_out", false)
+	plays.Element(1).Object().ValueEqual("sound_id", s2.Id)
+}
+
+func TestExportImport(t *testing.T) {
+	setup()
+
+	sut := newServer()
+	defer sut.Close()
+
+	s1 := NewSound()
+	s1.Name = "s1"
+	s1.Hidden = false
+	_ = soundProvider.Save(&s1)
+	_ = soundProvider.WriteAudio(&s1, bytes.NewReader([]byte{1, 2, 3}))
+
+	s2 := NewSound()
+	s2.Name = "s2"
+	s2.Hidden = false
+	_ = soundProvider.Save(&s2)
+	_ = soundProvider.WriteAudio(&s2, bytes.NewReader([]byte{4, 5, 6}))
+
+	hidden := NewSound()
+	_ = soundProvider.Save(&hidden)
+
+	g1 := NewGroup()
+	g1.Name = "g1"
+	g1.SoundIds = []string{s1.Id, s2.Id}
+	_ = groupProvider.Save(&g1)
+
+	// export
+	export := httpexpect.New(t, sut.URL).
+		GET("/sound/export/").
+		Expect().
+		Status(http.StatusOK).
+		ContentType("application/zip").
+		Body().
+		Raw()
+
+	manifest, err := Export(ioutil.Discard, soundProvider, groupProvider)
+	assert.NoError(t, err)
+	assert.Len(t, manifest.Sounds, 2)
+	assert.Len(t, manifest.Groups, 1)
+
+	// importing existing sounds is a no-op
+	result := httpexpect.New(t, sut.URL).
+		POST("/sound/import/").
+		WithBytes([]byte(export)).
+		Expect().
+		Status(http.StatusCreated).
+		JSON().
+		Object()
+	result.Value("sounds").Array().Empty()
+	result.Value("groups").Array().Empty()
+	result.Value("duplicates").Equal(2)
+
+	// invalid archive
+	httpexpect.New(t, sut.URL).
+		POST("/sound/import/").
+		WithBytes([]byte("foo")).
+		Expect().
+		Status(http.StatusNotAcceptable)
+}
+
+func TestImportIntoAnotherServer(t *testing.T) {
+	setup()
+
+	source := newServer()
+	defer source.Close()
+
+	s1, err := soundProvider.NewSound("s1.wav", ioutil.NopCloser(bytes.NewReader(tone(10))), maxDuration)
+	assert.NoError(t, err)
+	s1.Name = "s1"
+	s1.Hidden = false
+	_ = soundProvider.Save(s1)
+
+	s2, err := soundProvider.NewSound("s2.wav", ioutil.NopCloser(bytes.NewReader(tone(20))), maxDuration)
+	assert.NoError(t, err)
+	s2.Name = "s2"
+	s2.Hidden = false
+	_ = soundProvider.Save(s2)
+
+	g1 := NewGroup()
+	g1.Name = "g1"
+	g1.SoundIds = []string{s1.Id, s2.Id}
+	_ = groupProvider.Save(&g1)
+
+	export := httpexpect.New(t, source.URL).
+		GET("/sound/export/").
+		Expect().
+		Status(http.StatusOK).
+		Body().
+		Raw()
+
+	// a server with its own store
+	setup()
+
+	sut := newServer()
+	defer sut.Close()
+
+	result := httpexpect.New(t, sut.URL).
+		POST("/sound/import/").
+		WithBytes([]byte(export)).
+		Expect().
+		Status(http.StatusCreated).
+		JSON().
+		Object()
+	result.Value("sounds").Array().Length().Equal(2)
+	result.Value("groups").Array().Length().Equal(1)
+	result.Value("duplicates").Equal(0)
+
+	// the imported audio was normalized again, importing the archive twice is still a no-op
+	result = httpexpect.New(t, sut.URL).
+		POST("/sound/import/").
+		WithBytes([]byte(export)).
+		Expect().
+		Status(http.StatusCreated).
+		JSON().
+		Object()
+	result.Value("sounds").Array().Empty()
+	result.Value("groups").Array().Empty()
+	result.Value("duplicates").Equal(2)
+
+	assert.Len(t, soundProvider.List(), 2)
+	assert.Len(t, groupProvider.List(), 1)
+}
+
+// tone returns a tenth of a second of a mono 16 bit wav square wave with a period of period samples.
+func tone(period int) []byte {
+	const samples = 4410
+
+	var buf bytes.Buffer
+
+	_, _ = buf.WriteString("RIFF")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(36+2*samples))
+	_, _ = buf.WriteString("WAVEfmt ")
+	for _, v := range []interface{}{uint32(16), uint16(1), uint16(1), uint32(44100), uint32(88200), uint16(2), uint16(16)} {
+		_ = binary.Write(&buf, binary.LittleEndian, v)
+	}
+	_, _ = buf.WriteString("data")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(2*samples))
+
+	for i := 0; i < samples; i++ {
+		sample := int16(8192)
+		if (i/period)%2 == 1 {
+			sample = -sample
+		}
+
+		_ = binary.Write(&buf, binary.LittleEndian, sample)
+	}
+
+	return buf.Bytes()
+}
+
+func TestClusterQueue(t *testing.T) {
+	setup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pubSub := &cluster.MemoryPubSub{}
+
+	newReplica := func(leader bool) *Service {
+		replica := &Service{
+			SoundProvider:    soundProvider,
+			GroupProvider:    groupProvider,
+			WebsocketService: &websocketService,
+			Cluster:          cluster.New(pubSub, cluster.StaticElector{IsLeader: leader}),
+			playQueue: playQueue{
+				playChannel: make(chan bool, 1),
+				sounds:      make([]Sound, 0),
+			},
+		}
+		replica.playQueue.changed = replica.publishQueueState
+
+		assert.NoError(t, pubSub.Subscribe(ctx, queueChannel, replica.applyQueueCommand))
+		assert.NoError(t, pubSub.Subscribe(ctx, queueStateChannel, replica.receiveQueueState))
+
+		return replica
+	}
+
+	leader := newReplica(true)
+	follower := newReplica(false)
+
+	s1 := NewSound()
+	s2 := NewSound()
+
+	// followers send their commands to the leader
+	follower.enqueue(s1, s2)
+
+	assert.Len(t, leader.playQueue.List(), 2)
+	assert.Empty(t, follower.playQueue.List())
+
+	// followers serve the queue of the leader
+	queued := follower.queued()
+	assert.Len(t, queued, 2)
+	assert.Equal(t, s1.Id, queued[0].Id)
+	assert.Equal(t, s2.Id, queued[1].Id)
+
+	follower.clearQueue()
+
+	assert.Empty(t, leader.queued())
+	assert.Empty(t, follower.queued())
+}
+
+func TestChangeMessages(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	feed := storage.NewFeedStore(memory.New())
+	ws := &websocket.Service{AuthService: &auth.Service{}}
+
+	replica := &Service{
+		SoundProvider:    &SoundProvider{Store: feed},
+		GroupProvider:    &GroupProvider{Store: feed},
+		WebsocketService: ws,
+		Feed:             feed,
+	}
+	_ = replica.SoundProvider.Initialize()
+	_ = replica.GroupProvider.Initialize()
+
+	router := mux.NewRouter()
+	ws.RegisterRoutes(router)
+	replica.RegisterRoutes(router)
+
+	sut := httptest.NewServer(router)
+	defer sut.Close()
+
+	replica.watch(ctx)
+
+	conn, _, err := gorilla.DefaultDialer.Dial("ws"+strings.TrimPrefix(sut.URL, "http")+"/ws/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// the connection is registered once it is sent the sequence
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err = conn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+
+	var order []websocket.MessageType
+
+	// next returns the type and id of the next n sound and group messages
+	next := func(n int) map[string]websocket.MessageType {
+		messages := map[string]websocket.MessageType{}
+		order = nil
+
+		for len(messages) < n {
+			var msg struct {
+				Type  websocket.MessageType `json:"type"`
+				Sound *Sound                `json:"sound"`
+				Group *Group                `json:"group"`
+			}
+
+			_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+			if err := conn.ReadJSON(&msg); err != nil {
+				t.Fatal(err)
+			}
+
+			switch {
+			case msg.Sound != nil:
+				messages[msg.Sound.Id] = msg.Type
+			case msg.Group != nil:
+				messages[msg.Group.Id] = msg.Type
+			default:
+				continue
+			}
+
+			order = append(order, msg.Type)
+		}
+
+		return messages
+	}
+
+	s1 := NewSound()
+	s2 := NewSound()
+	s2.Name = "s2"
+	s2.Hidden = false
+
+	// hidden sounds are not sent to clients
+	_ = replica.SoundProvider.Save(&s1)
+	_ = replica.SoundProvider.Save(&s2)
+	assert.Equal(t, map[string]websocket.MessageType{s2.Id: websocket.CreateSoundMessageType}, next(1))
+
+	// sounds are created when they become visible
+	httpexpect.New(t, sut.URL).
+		PATCH(fmt.Sprintf("/sound/sounds/%s/", s1.Id)).
+		WithJSON(map[string]string{"name": "s1"}).
+		Expect().
+		Status(http.StatusAccepted)
+	assert.Equal(t, map[string]websocket.MessageType{s1.Id: websocket.CreateSoundMessageType}, next(1))
+
+	httpexpect.New(t, sut.URL).
+		PATCH(fmt.Sprintf("/sound/sounds/%s/", s1.Id)).
+		WithJSON(map[string]string{"name": "s1 renamed"}).
+		Expect().
+		Status(http.StatusAccepted)
+	assert.Equal(t, map[string]websocket.MessageType{s1.Id: websocket.UpdateSoundMessageType}, next(1))
+
+	group := httpexpect.New(t, sut.URL).
+		POST("/sound/groups/").
+		WithJSON(map[string]interface{}{"name": "g1", "sounds": []string{s1.Id, s2.Id}}).
+		Expect().
+		Status(http.StatusCreated).
+		JSON().Object()
+	groupId := group.Value("id").String().Raw()
+	assert.Equal(t, map[string]websocket.MessageType{groupId: websocket.CreateGroupMessageType}, next(1))
+
+	httpexpect.New(t, sut.URL).
+		DELETE(fmt.Sprintf("/sound/sounds/%s/", s1.Id)).
+		Expect().
+		Status(http.StatusNoContent)
+	assert.Equal(t, map[string]websocket.MessageType{
+		s1.Id:   websocket.DeleteSoundMessageType,
+		groupId: websocket.DeleteGroupMessageType,
+	}, next(2))
+
+	// clients drop the group before the sound it plays
+	assert.Equal(t, []websocket.MessageType{websocket.DeleteGroupMessageType, websocket.DeleteSoundMessageType}, order)
+}
+
+func TestChangedIds(t *testing.T) {
+	setup()
+
+	sound := NewSound()
+	group := NewGroup()
+
+	replica := &Service{SoundProvider: soundProvider, GroupProvider: groupProvider}
+
+	c := storage.Change{Keys: [][]byte{
+		soundProvider.ObjectKey(&sound).Bytes(),
+		soundProvider.FieldKey(&sound, "Audio").Bytes(),
+		groupProvider.ObjectKey(&group).Bytes(),
+	}}
+
+	assert.Equal(t, map[string]bool{sound.Id: true}, replica.changedSounds(c))
+	assert.Equal(t, map[string]bool{group.Id: true}, replica.changedGroups(c))
+}
@@ -29,56 +29,46 @@ func NewSound() Sound {
 }
 
 func (p *SoundProvider) NewSound(filename string, audio io.ReadCloser, maxDuration time.Duration) (*Sound, error) {
-	var err error
 	var buf bytes.Buffer
 
-	sound := NewSound()
-
-	sound.Duration, err = normalizeAudio(filename, maxDuration, audio, &buf)
+	duration, err := normalizeAudio(filename, maxDuration, audio, &buf)
 	if err != nil {
 		return nil, service.NotAcceptableError{SpeakerbobError: "unable to interpret audio format"}
 	}
 
-	err = p.Save(&sound)
-	if err != nil {
-		return nil, err
-	}
-
-	err = p.WriteAudio(&sound, &buf)
-	if err != nil {
-		return nil, err
-	}
-
-	return &sound, err
+	return p.newSound(duration, &buf)
 }
 
 func (p *SoundProvider) NewTTSSound(text string, maxDuration time.Duration) (*Sound, error) {
-	var err error
 	var buf bytes.Buffer
 	var normBuf bytes.Buffer
 
-	// create a new sound
-	sound := NewSound()
-	sound.Hidden = true
-
 	// codegen audio
-	err = tts(text, &buf)
+	err := tts(text, &buf)
 	if err != nil {
 		return nil, err
 	}
 
 	// normalize audio
-	sound.Duration, err = normalizeAudio("f.wav", maxDuration, &buf, &normBuf)
+	duration, err := normalizeAudio("f.wav", maxDuration, &buf, &normBuf)
 	if err != nil {
 		return nil, err
 	}
 
-	err = p.Save(&sound)
+	return p.newSound(duration, &normBuf)
+}
+
+// newSound saves a hidden sound with normalized audio.
+func (p *SoundProvider) newSound(duration time.Duration, audio io.Reader) (*Sound, error) {
+	sound := NewSound()
+	sound.Duration = duration
+
+	err := p.Save(&sound)
 	if err != nil {
 		return nil, err
 	}
 
-	err = p.WriteAudio(&sound, &normBuf)
+	err = p.WriteAudio(&sound, audio)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,277 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"github.com/paynejacob/hotcereal/pkg/provider"
+	"github.com/paynejacob/hotcereal/pkg/store"
+	"github.com/sirupsen/logrus"
+	"io"
+	"sync"
+)
+
+// Change lists keys that were written to a store.
+type Change struct {
+	Keys [][]byte
+
+	// Remote changes were written by another process, the caches of providers are stale until they are reloaded.
+	Remote bool
+}
+
+// Has returns true if one of the changed keys starts with prefix.
+func (c Change) Has(prefix store.TypeKey) bool {
+	p := prefix.Bytes()
+	for i := range c.Keys {
+		if bytes.HasPrefix(c.Keys[i], p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Feed notifies handlers of the keys written to a store.
+type Feed interface {
+	// Watch calls handler with every change to keys starting with one of prefixes until ctx is done. Handlers are
+	// called after the write returns, one change at a time in the order they were written.
+	Watch(ctx context.Context, prefixes []store.TypeKey, handler func(Change)) error
+}
+
+// FindFeed returns the feed of s or of the first store it wraps that has one.
+func FindFeed(s store.Store) (Feed, bool) {
+	for {
+		if feed, ok := s.(Feed); ok {
+			return feed, true
+		}
+
+		wrapper, ok := s.(interface{ Unwrap() store.Store })
+		if !ok {
+			return nil, false
+		}
+
+		s = wrapper.Unwrap()
+	}
+}
+
+// Refresh reloads the cache of a provider when another process writes one of its keys, until ctx is done. Providers
+// without a type key are never reloaded.
+func Refresh(ctx context.Context, feed Feed, providers []provider.Provider) error {
+	var prefixes []store.TypeKey
+
+	for _, p := range providers {
+		if typed, ok := p.(interface{ TypeKey() store.TypeKey }); ok {
+			prefixes = append(prefixes, typed.TypeKey())
+		}
+	}
+
+	return feed.Watch(ctx, prefixes, func(c Change) {
+		// our own writes are already cached
+		if !c.Remote {
+			return
+		}
+
+		for _, p := range providers {
+			typed, ok := p.(interface{ TypeKey() store.TypeKey })
+			if !ok || !c.Has(typed.TypeKey()) {
+				continue
+			}
+
+			if err := p.Initialize(); err != nil {
+				logrus.Errorf("[storage.Refresh] unable to reload provider: %v", err)
+			}
+		}
+	})
+}
+
+// FeedStore notifies watchers of the writes made through it, it gives stores without a change feed of their own one.
+type FeedStore struct {
+	store.Store
+
+	m        sync.RWMutex
+	watchers []*watcher
+}
+
+type watcher struct {
+	prefixes []store.TypeKey
+	queue    func(Change)
+}
+
+func NewFeedStore(s store.Store) *FeedStore {
+	return &FeedStore{Store: s}
+}
+
+// Unwrap returns the wrapped store.
+func (s *FeedStore) Unwrap() store.Store {
+	return s.Store
+}
+
+func (s *FeedStore) Watch(ctx context.Context, prefixes []store.TypeKey, handler func(Change)) error {
+	w := &watcher{prefixes: prefixes, queue: Ordered(ctx, handler)}
+
+	s.m.Lock()
+	s.watchers = append(s.watchers, w)
+	s.m.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		s.m.Lock()
+		defer s.m.Unlock()
+
+		for i := range s.watchers {
+			if s.watchers[i] == w {
+				s.watchers = append(s.watchers[:i:i], s.watchers[i+1:]...)
+				break
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (s *FeedStore) WriteLazy(key store.FieldKey, r io.Reader) error {
+	if err := s.Store.WriteLazy(key, r); err != nil {
+		return err
+	}
+
+	s.notify(key)
+
+	return nil
+}
+
+func (s *FeedStore) Save(key store.Key, value []byte) error {
+	if err := s.Store.Save(key, value); err != nil {
+		return err
+	}
+
+	s.notify(key)
+
+	return nil
+}
+
+func (s *FeedStore) BulkSave(m map[store.Key][]byte) error {
+	if err := s.Store.BulkSave(m); err != nil {
+		return err
+	}
+
+	keys := make([]store.Key, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	s.notify(keys...)
+
+	return nil
+}
+
+func (s *FeedStore) Delete(keys ...store.Key) error {
+	if err := s.Store.Delete(keys...); err != nil {
+		return err
+	}
+
+	s.notify(keys...)
+
+	return nil
+}
+
+// OpenLazy opens a lazy field of the wrapped store for reading from any offset, fields of stores that can not open
+// them are read into memory.
+func (s *FeedStore) OpenLazy(key store.FieldKey) (io.ReadSeekCloser, error) {
+	if opener, ok := s.Store.(interface {
+		OpenLazy(store.FieldKey) (io.ReadSeekCloser, error)
+	}); ok {
+		return opener.OpenLazy(key)
+	}
+
+	var buf bytes.Buffer
+	if err := s.Store.ReadLazy(key, &buf); err != nil {
+		return nil, err
+	}
+
+	return nopCloser{bytes.NewReader(buf.Bytes())}, nil
+}
+
+// MoveLazy moves a lazy field of the wrapped store written by an older version, moved is false if the wrapped store
+// does not move fields. The content of the field is unchanged so watchers are not notified.
+func (s *FeedStore) MoveLazy(key store.FieldKey) (moved bool, err error) {
+	if mover, ok := s.Store.(interface {
+		MoveLazy(store.FieldKey) (bool, error)
+	}); ok {
+		return mover.MoveLazy(key)
+	}
+
+	return false, nil
+}
+
+// notify queues the change for the watchers of keys so writers never wait for handlers, handlers may write.
+func (s *FeedStore) notify(keys ...store.Key) {
+	c := Change{Keys: make([][]byte, len(keys))}
+	for i := range keys {
+		c.Keys[i] = keys[i].Bytes()
+	}
+
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	for _, w := range s.watchers {
+		for _, prefix := range w.prefixes {
+			if c.Has(prefix) {
+				w.queue(c)
+				break
+			}
+		}
+	}
+}
+
+// Ordered returns a function that queues changes for handler without waiting for it. Handler is called with one change
+// at a time, in the order they were queued, until ctx is done.
+func Ordered(ctx context.Context, handler func(Change)) func(Change) {
+	var m sync.Mutex
+	var queued []Change
+
+	wake := make(chan struct{}, 1)
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-wake:
+			}
+
+			for {
+				m.Lock()
+				if len(queued) == 0 {
+					m.Unlock()
+					break
+				}
+
+				c := queued[0]
+				queued[0] = Change{}
+				queued = queued[1:]
+				m.Unlock()
+
+				handler(c)
+			}
+		}
+	}()
+
+	return func(c Change) {
+		m.Lock()
+		queued = append(queued, c)
+		m.Unlock()
+
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,25 @@
+package storage
+
+import "errors"
+
+// Driver selects the database the server stores its data in.
+type Driver string
+
+const (
+	BadgerDriver Driver = "badger"
+	BoltDriver   Driver = "bolt"
+
+	// RedisDriver stores data in a redis compatible server, it is the only driver replicas can share.
+	RedisDriver Driver = "redis"
+)
+
+// Drivers are the supported drivers, the first is the default.
+var Drivers = []Driver{BadgerDriver, BoltDriver, RedisDriver}
+
+var (
+	// ErrNotFound is returned when reading a key that does not exist.
+	ErrNotFound = errors.New("key not found")
+
+	// ErrLocked is returned when another process, usually a running server, has the database open.
+	ErrLocked = errors.New("the database is in use by another process")
+)
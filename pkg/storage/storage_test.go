@@ -0,0 +1,23 @@
+package storage_test
+
+import (
+	"github.com/paynejacob/hotcereal/pkg/store"
+	"github.com/paynejacob/hotcereal/pkg/stores/memory"
+	"github.com/paynejacob/speakerbob/pkg/storage"
+	"github.com/paynejacob/speakerbob/pkg/storage/storagetest"
+	"testing"
+)
+
+func TestMemoryStore(t *testing.T) {
+	storagetest.Run(t, func(*testing.T) store.Store {
+		return memory.New()
+	})
+}
+
+func TestFeedStore(t *testing.T) {
+	storagetest.RunFeed(t, func(*testing.T) (store.Store, storage.Feed) {
+		s := storage.NewFeedStore(memory.New())
+
+		return s, s
+	})
+}
@@ -0,0 +1,76 @@
+package storagetest
+
+import (
+	"context"
+	"github.com/paynejacob/hotcereal/pkg/store"
+	"github.com/paynejacob/speakerbob/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// RunFeed runs the change feed suite, newStore must return an empty store and its feed.
+func RunFeed(t *testing.T, newStore func(t *testing.T) (store.Store, storage.Feed)) {
+	fooType := store.TypeKey{Body: "testFoo", PackageLength: 4, TypeLength: 3}
+	barType := store.TypeKey{Body: "testBar", PackageLength: 4, TypeLength: 3}
+
+	s, feed := newStore(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var m sync.Mutex
+	var keys []string
+
+	assert.NoError(t, feed.Watch(ctx, []store.TypeKey{fooType}, func(c storage.Change) {
+		m.Lock()
+		defer m.Unlock()
+
+		assert.False(t, c.Remote)
+		for i := range c.Keys {
+			keys = append(keys, string(c.Keys[i]))
+		}
+	}))
+
+	// some feeds register in the background
+	time.Sleep(100 * time.Millisecond)
+
+	watched := func() []string {
+		m.Lock()
+		defer m.Unlock()
+
+		return append([]string{}, keys...)
+	}
+
+	a, b := objectKey(fooType, "a"), objectKey(fooType, "b")
+
+	assert.NoError(t, s.Save(a, []byte("a")))
+	assert.NoError(t, s.Save(objectKey(barType, "c"), []byte("c")))
+	assert.NoError(t, s.BulkSave(map[store.Key][]byte{b: []byte("b")}))
+	assert.NoError(t, s.Delete(a))
+
+	expected := []string{string(a.Bytes()), string(b.Bytes()), string(a.Bytes())}
+	assert.Eventually(t, func() bool { return len(watched()) >= len(expected) }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, expected, watched())
+
+	// changes are delivered in the order they were written
+	for i := 0; i < 100; i++ {
+		key := objectKey(fooType, strconv.Itoa(i))
+		assert.NoError(t, s.Save(key, []byte("c")))
+
+		expected = append(expected, string(key.Bytes()))
+	}
+
+	assert.Eventually(t, func() bool { return len(watched()) >= len(expected) }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, expected, watched())
+
+	// canceled watches stop
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+
+	assert.NoError(t, s.Save(a, []byte("a")))
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(t, watched(), len(expected))
+}
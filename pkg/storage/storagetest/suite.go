@@ -0,0 +1,122 @@
+// Package storagetest is the conformance suite every store backend must pass.
+package storagetest
+
+import (
+	"bytes"
+	"github.com/paynejacob/hotcereal/pkg/store"
+	"github.com/paynejacob/speakerbob/pkg/storage"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"testing"
+)
+
+func objectKey(typeKey store.TypeKey, id string) store.ObjectKey {
+	k := store.ObjectKey{TypeKey: typeKey, IdLength: len(id)}
+	k.Body += id
+
+	return k
+}
+
+func fieldKey(typeKey store.TypeKey, id string, field string) store.FieldKey {
+	k := store.FieldKey{ObjectKey: objectKey(typeKey, id), FieldLength: len(field)}
+	k.Body += field
+
+	return k
+}
+
+// Run runs the suite, newStore must return an empty store.
+func Run(t *testing.T, newStore func(t *testing.T) store.Store) {
+	fooType := store.TypeKey{Body: "testFoo", PackageLength: 4, TypeLength: 3}
+	barType := store.TypeKey{Body: "testBar", PackageLength: 4, TypeLength: 3}
+
+	t.Run("Get", func(t *testing.T) {
+		s := newStore(t)
+
+		// missing keys
+		value, err := s.Get(objectKey(fooType, "a"))
+		if err != nil {
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+		}
+		assert.Empty(t, value)
+
+		assert.NoError(t, s.Save(objectKey(fooType, "a"), []byte("foo")))
+
+		value, err = s.Get(objectKey(fooType, "a"))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("foo"), value)
+
+		// overwrite
+		assert.NoError(t, s.Save(objectKey(fooType, "a"), []byte("bar")))
+
+		value, err = s.Get(objectKey(fooType, "a"))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("bar"), value)
+	})
+
+	t.Run("List", func(t *testing.T) {
+		var values []string
+
+		s := newStore(t)
+
+		assert.NoError(t, s.BulkSave(map[store.Key][]byte{
+			objectKey(fooType, "a"): []byte("a"),
+			objectKey(fooType, "b"): []byte("b"),
+			objectKey(barType, "c"): []byte("c"),
+		}))
+		assert.NoError(t, s.WriteLazy(fieldKey(fooType, "a", "Audio"), bytes.NewReader([]byte("audio"))))
+
+		err := s.List(fooType, func(value []byte) error {
+			values = append(values, string(value))
+			return nil
+		})
+		assert.NoError(t, err)
+
+		// other types and field keys are not listed
+		sort.Strings(values)
+		assert.Equal(t, []string{"a", "b"}, values)
+	})
+
+	t.Run("Lazy", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		s := newStore(t)
+
+		// missing keys
+		if err := s.ReadLazy(fieldKey(fooType, "a", "Audio"), &buf); err != nil {
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+		}
+		assert.Zero(t, buf.Len())
+
+		audio := bytes.Repeat([]byte{1, 2, 3}, 1<<16)
+		assert.NoError(t, s.WriteLazy(fieldKey(fooType, "a", "Audio"), bytes.NewReader(audio)))
+
+		assert.NoError(t, s.ReadLazy(fieldKey(fooType, "a", "Audio"), &buf))
+		assert.Equal(t, audio, buf.Bytes())
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		var count int
+
+		s := newStore(t)
+
+		assert.NoError(t, s.BulkSave(map[store.Key][]byte{
+			objectKey(fooType, "a"): []byte("a"),
+			objectKey(fooType, "b"): []byte("b"),
+		}))
+
+		// missing keys are ignored
+		assert.NoError(t, s.Delete(objectKey(fooType, "a"), objectKey(fooType, "missing")))
+
+		assert.NoError(t, s.List(fooType, func([]byte) error {
+			count++
+			return nil
+		}))
+		assert.Equal(t, 1, count)
+
+		value, err := s.Get(objectKey(fooType, "a"))
+		if err != nil {
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+		}
+		assert.Empty(t, value)
+	})
+}
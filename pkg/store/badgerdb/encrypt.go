@@ -0,0 +1,167 @@
+package badgerdb
+
+import (
+	"fmt"
+	"github.com/dgraph-io/badger/v3"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// writes badger may have pending while copying a database
+	maxPendingWrites = 256
+
+	encryptingDir = ".encrypting"
+	plaintextDir  = ".unencrypted"
+)
+
+// Encrypt encrypts the unencrypted database in path with key. Badger can not encrypt existing data so the data is
+// copied into a new encrypted database which then replaces the database files in path, files in path that do not
+// belong to the database are kept.
+func Encrypt(path string, key []byte) error {
+	if err := ValidateKey(key); err != nil {
+		return err
+	}
+
+	src, err := Open(path, nil)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(path, encryptingDir)
+	if err = os.RemoveAll(tmp); err != nil {
+		_ = src.Close()
+		return err
+	}
+
+	dst, err := Open(tmp, key)
+	if err != nil {
+		_ = src.Close()
+		return err
+	}
+
+	err = copyDB(src.DB, dst.DB)
+
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := src.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.RemoveAll(tmp)
+		return err
+	}
+
+	return replaceFiles(path, tmp)
+}
+
+// RotateKey encrypts the database in path with newKey instead of oldKey. Badger encrypts its data with data keys that
+// are encrypted with the key, only the data keys are encrypted again.
+func RotateKey(path string, oldKey []byte, newKey []byte) error {
+	if err := ValidateKey(newKey); err != nil {
+		return err
+	}
+
+	// opening the database checks the old key and that no server is using the directory
+	db, err := Open(path, oldKey)
+	if err != nil {
+		return err
+	}
+
+	if err = db.Close(); err != nil {
+		return err
+	}
+
+	options := badger.KeyRegistryOptions{
+		Dir:                           path,
+		ReadOnly:                      true,
+		EncryptionKey:                 oldKey,
+		EncryptionKeyRotationDuration: badger.DefaultOptions(path).EncryptionKeyRotationDuration,
+	}
+
+	registry, err := badger.OpenKeyRegistry(options)
+	if err != nil {
+		return err
+	}
+	defer registry.Close()
+
+	options.EncryptionKey = newKey
+
+	return badger.WriteKeyRegistry(registry, options)
+}
+
+// copyDB copies every key of src into dst.
+func copyDB(src *badger.DB, dst *badger.DB) error {
+	r, w := io.Pipe()
+
+	go func() {
+		_, err := src.Backup(w, 0)
+		_ = w.CloseWithError(err)
+	}()
+
+	err := dst.Load(r, maxPendingWrites)
+	_ = r.CloseWithError(err)
+
+	return err
+}
+
+// replaceFiles replaces the database files in path with the database files in dir and removes dir. The old files are
+// moved aside first, if this fails part way both copies are still on disk.
+func replaceFiles(path string, dir string) error {
+	old := filepath.Join(path, fmt.Sprintf("%s-%d", plaintextDir, time.Now().Unix()))
+
+	if err := moveFiles(path, old); err != nil {
+		return fmt.Errorf("unable to move the unencrypted database to %s: %w", old, err)
+	}
+
+	if err := moveFiles(dir, path); err != nil {
+		return fmt.Errorf("unable to move the encrypted database from %s, the unencrypted database is in %s: %w", dir, old, err)
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+
+	return os.RemoveAll(old)
+}
+
+// moveFiles moves the database files in src to dst.
+func moveFiles(src string, dst string) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(dst, 0700); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !isDatabaseFile(entry.Name()) {
+			continue
+		}
+
+		if err = os.Rename(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func isDatabaseFile(name string) bool {
+	switch filepath.Ext(name) {
+	case ".sst", ".vlog", ".mem":
+		return true
+	}
+
+	switch name {
+	case "MANIFEST", "KEYREGISTRY", "DISCARD", "LOCK":
+		return true
+	}
+
+	return false
+}
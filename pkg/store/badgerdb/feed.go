@@ -0,0 +1,40 @@
+package badgerdb
+
+import (
+	"context"
+	"errors"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/dgraph-io/badger/v3/pb"
+	"github.com/paynejacob/hotcereal/pkg/store"
+	"github.com/paynejacob/speakerbob/pkg/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// Watch calls handler with the keys written to the database. Badger only sees writes made through this process, the
+// database is locked while it is open. The subscription is registered in the background, writes made right after
+// Watch returns may be missed.
+func (b Store) Watch(ctx context.Context, prefixes []store.TypeKey, handler func(storage.Change)) error {
+	matches := make([]pb.Match, len(prefixes))
+	for i := range prefixes {
+		matches[i] = pb.Match{Prefix: prefixes[i].Bytes()}
+	}
+
+	go func() {
+		err := b.DB.Subscribe(ctx, func(kvs *badger.KVList) error {
+			c := storage.Change{Keys: make([][]byte, len(kvs.Kv))}
+			for i := range kvs.Kv {
+				c.Keys[i] = kvs.Kv[i].Key
+			}
+
+			handler(c)
+
+			return nil
+		}, matches)
+
+		if err != nil && !errors.Is(err, context.Canceled) {
+			logrus.Errorf("[badgerdb.Watch] subscription ended: %v", err)
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package badgerdb
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+const (
+	gcInterval = time.Hour
+
+	// a value log file is rewritten once at least this ratio of it is garbage
+	gcDiscardRatio = 0.5
+)
+
+var (
+	gcRuns         = expvar.NewInt("badger_gc_runs")
+	gcRewrites     = expvar.NewInt("badger_gc_rewrites")
+	gcErrors       = expvar.NewInt("badger_gc_errors")
+	gcDuration     = expvar.NewFloat("badger_gc_last_duration_seconds")
+	gcLastFinished = expvar.NewInt("badger_gc_last_finished")
+)
+
+// GCService reclaims the disk space of deleted and overwritten values, badger never does this on its own.
+type GCService struct {
+	DB *badger.DB
+}
+
+func (s GCService) RegisterRoutes(*mux.Router) {}
+
+func (s GCService) Run(ctx context.Context) {
+	ticker := time.NewTicker(gcInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.collect(); err != nil {
+				logrus.Errorf("[badgerdb.GCService] garbage collection failed: %v", err)
+			}
+		}
+	}
+}
+
+// collect rewrites value log files until none has enough garbage. The lsm tree is left to badger's own compactions,
+// flattening it blocks writes for as long as it runs.
+func (s GCService) collect() error {
+	start := time.Now()
+
+	gcRuns.Add(1)
+	defer func() {
+		gcDuration.Set(time.Since(start).Seconds())
+		gcLastFinished.Set(time.Now().Unix())
+	}()
+
+	return runValueLogGC(s.DB)
+}
+
+// Compact compacts the lsm tree into a single level and then collects garbage. Flattening drops the keys of deleted
+// values so the value log files holding them count as garbage, it blocks writes and is only run by admins.
+func Compact(db *badger.DB) error {
+	if err := db.Flatten(1); err != nil {
+		return err
+	}
+
+	return runValueLogGC(db)
+}
+
+func runValueLogGC(db *badger.DB) error {
+	for {
+		err := db.RunValueLogGC(gcDiscardRatio)
+		if errors.Is(err, badger.ErrNoRewrite) {
+			return nil
+		}
+		if err != nil {
+			gcErrors.Add(1)
+			return err
+		}
+
+		gcRewrites.Add(1)
+	}
+}
@@ -0,0 +1,58 @@
+package badgerdb
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/paynejacob/speakerbob/pkg/storage"
+	"github.com/sirupsen/logrus"
+	"syscall"
+)
+
+// badger caches the decrypted block indexes of encrypted tables
+const encryptedIndexCacheSize = 64 << 20
+
+// ErrEncryptionKey is returned when a database is opened with a key it was not encrypted with, or without a key
+// while it is encrypted.
+var ErrEncryptionKey = errors.New("the encryption key does not match the data directory")
+
+// Open opens the badger database in path. The database is encrypted with key unless key is empty, keys are 16, 24 or
+// 32 bytes for AES-128, AES-192 or AES-256.
+func Open(path string, key []byte) (Store, error) {
+	options := badger.DefaultOptions(path)
+	options.Logger = logrus.StandardLogger()
+
+	if len(key) > 0 {
+		if err := ValidateKey(key); err != nil {
+			return Store{}, err
+		}
+
+		options = options.WithEncryptionKey(key).WithIndexCacheSize(encryptedIndexCacheSize)
+	}
+
+	db, err := badger.Open(options)
+	if err != nil {
+		// badger holds an exclusive lock on the directory while it is open
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return Store{}, storage.ErrLocked
+		}
+
+		if errors.Is(err, badger.ErrEncryptionKeyMismatch) {
+			return Store{}, ErrEncryptionKey
+		}
+
+		return Store{}, err
+	}
+
+	return Store{DB: db}, nil
+}
+
+// ValidateKey returns an error if key is not a valid AES key.
+func ValidateKey(key []byte) error {
+	switch len(key) {
+	case 16, 24, 32:
+		return nil
+	}
+
+	return fmt.Errorf("encryption keys must be 16, 24 or 32 bytes, the key is %d bytes", len(key))
+}
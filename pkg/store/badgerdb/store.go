@@ -1,8 +1,10 @@
 package badgerdb
 
 import (
+	"errors"
 	"github.com/dgraph-io/badger/v3"
 	"github.com/paynejacob/hotcereal/pkg/store"
+	"github.com/paynejacob/speakerbob/pkg/storage"
 	"io"
 )
 
@@ -11,22 +13,21 @@ type Store struct {
 }
 
 func (b Store) Get(key store.Key) ([]byte, error) {
-	var err error
-	var item *badger.Item
 	var rval []byte
 
-	err = b.DB.View(func(txn *badger.Txn) error {
-		item, err = txn.Get(key.Bytes())
+	err := b.DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key.Bytes())
+		if err == badger.ErrKeyNotFound {
+			return storage.ErrNotFound
+		}
 		if err != nil {
 			return err
 		}
 
-		err = item.Value(func(val []byte) error {
-			rval = val
-			return nil
-		})
+		// the value is only valid inside the transaction
+		rval, err = item.ValueCopy(nil)
 
-		return nil
+		return err
 	})
 
 	return rval, err
@@ -62,6 +63,9 @@ func (b Store) List(prefix store.TypeKey, process func([]byte) error) error {
 func (b Store) ReadLazy(key store.FieldKey, w io.Writer) error {
 	return b.DB.View(func(txn *badger.Txn) error {
 		item, err := txn.Get(key.Bytes())
+		if err == badger.ErrKeyNotFound {
+			return storage.ErrNotFound
+		}
 		if err != nil {
 			return err
 		}
@@ -89,23 +93,46 @@ func (b Store) Save(key store.Key, bytes []byte) error {
 }
 
 func (b Store) BulkSave(m map[store.Key][]byte) error {
-	return b.DB.Update(func(txn *badger.Txn) error {
-		for k, v := range m {
-			_ = txn.Set(k.Bytes(), v)
-		}
+	keys := make([]store.Key, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
 
-		return nil
+	return b.update(len(keys), func(txn *badger.Txn, i int) error {
+		return txn.Set(keys[i].Bytes(), m[keys[i]])
 	})
 }
 
 func (b Store) Delete(keys ...store.Key) error {
-	return b.DB.Update(func(txn *badger.Txn) error {
-		for i := range keys {
-			_ = txn.Delete(keys[i].Bytes())
+	return b.update(len(keys), func(txn *badger.Txn, i int) error {
+		return txn.Delete(keys[i].Bytes())
+	})
+}
+
+// update applies n writes, writes that do not fit in one transaction are committed in several. A failed commit
+// leaves the writes of the previous transactions in place.
+func (b Store) update(n int, apply func(txn *badger.Txn, i int) error) error {
+	txn := b.DB.NewTransaction(true)
+	defer func() {
+		txn.Discard()
+	}()
+
+	for i := 0; i < n; i++ {
+		err := apply(txn, i)
+		if errors.Is(err, badger.ErrTxnTooBig) {
+			if err = txn.Commit(); err != nil {
+				return err
+			}
+
+			txn = b.DB.NewTransaction(true)
+			err = apply(txn, i)
 		}
+		if err != nil {
+			return err
+		}
+	}
 
-		return nil
-	})
+	return txn.Commit()
 }
 
 func (b Store) Close() error {
@@ -0,0 +1,135 @@
+package badgerdb
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/paynejacob/hotcereal/pkg/store"
+	"github.com/paynejacob/speakerbob/pkg/storage"
+	"github.com/paynejacob/speakerbob/pkg/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) store.Store {
+		db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = db.Close() })
+
+		return Store{DB: db}
+	})
+}
+
+func TestWatch(t *testing.T) {
+	storagetest.RunFeed(t, func(t *testing.T) (store.Store, storage.Feed) {
+		db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = db.Close() })
+
+		return Store{DB: db}, Store{DB: db}
+	})
+}
+
+func TestLargeBatch(t *testing.T) {
+	// a small memtable limits transactions to a few hundred of these values
+	db, err := badger.Open(badger.DefaultOptions(t.TempDir()).
+		WithMemTableSize(1 << 20).
+		WithValueThreshold(1 << 10).
+		WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	s := Store{DB: db}
+	value := bytes.Repeat([]byte("a"), 512)
+
+	m := map[store.Key][]byte{}
+	keys := make([]store.Key, 0, 2000)
+	for i := 0; i < 2000; i++ {
+		k := objectKey(fmt.Sprintf("%04d", i))
+
+		m[k] = value
+		keys = append(keys, k)
+	}
+
+	assert.NoError(t, s.BulkSave(m))
+
+	for _, k := range keys {
+		v, err := s.Get(k)
+		assert.NoError(t, err)
+		assert.Equal(t, value, v)
+	}
+
+	assert.NoError(t, s.Delete(keys...))
+
+	for _, k := range keys {
+		_, err = s.Get(k)
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	}
+
+	// the deleted values are garbage now
+	assert.NoError(t, GCService{DB: db}.collect())
+	assert.NoError(t, Compact(db))
+}
+
+func TestEncrypt(t *testing.T) {
+	path := t.TempDir()
+	key := objectKey("a")
+	k1 := []byte("0123456789abcdef")
+	k2 := []byte("fedcba9876543210fedcba9876543210")
+
+	s, err := Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, s.Save(key, []byte("foo")))
+	assert.NoError(t, s.Close())
+
+	// other files in the data directory are kept
+	assert.NoError(t, os.Mkdir(filepath.Join(path, "blobs"), 0700))
+
+	assert.NoError(t, Encrypt(path, k1))
+	assert.DirExists(t, filepath.Join(path, "blobs"))
+
+	_, err = Open(path, nil)
+	assert.ErrorIs(t, err, ErrEncryptionKey)
+
+	assertValue(t, path, k1, key, "foo")
+
+	// rotate
+	assert.NoError(t, RotateKey(path, k1, k2))
+
+	_, err = Open(path, k1)
+	assert.ErrorIs(t, err, ErrEncryptionKey)
+
+	assertValue(t, path, k2, key, "foo")
+
+	assert.Error(t, RotateKey(path, k2, []byte("short")))
+}
+
+func assertValue(t *testing.T, path string, encryptionKey []byte, key store.Key, expected string) {
+	s, err := Open(path, encryptionKey)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer s.Close()
+
+	value, err := s.Get(key)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, string(value))
+}
+
+func objectKey(id string) store.ObjectKey {
+	k := store.ObjectKey{TypeKey: store.TypeKey{Body: "testFoo", PackageLength: 4, TypeLength: 3}, IdLength: len(id)}
+	k.Body += id
+
+	return k
+}
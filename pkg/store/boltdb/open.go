@@ -0,0 +1,40 @@
+package boltdb
+
+import (
+	"errors"
+	"github.com/paynejacob/speakerbob/pkg/storage"
+	bolt "go.etcd.io/bbolt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileName is the name of the database file in the data directory.
+const FileName = "speakerbob.db"
+
+// Open opens the bolt database in the directory path, creating it if it does not exist.
+func Open(path string) (Store, error) {
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return Store{}, err
+	}
+
+	// bolt holds an exclusive lock on the file while it is open, do not wait for it
+	db, err := bolt.Open(filepath.Join(path, FileName), 0600, &bolt.Options{Timeout: time.Second})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return Store{}, storage.ErrLocked
+	}
+	if err != nil {
+		return Store{}, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return Store{}, err
+	}
+
+	return Store{DB: db}, nil
+}
@@ -0,0 +1,110 @@
+package boltdb
+
+import (
+	"bytes"
+	"github.com/paynejacob/hotcereal/pkg/store"
+	"github.com/paynejacob/speakerbob/pkg/storage"
+	bolt "go.etcd.io/bbolt"
+	"io"
+)
+
+// bucket holds every key, keys are already namespaced by their type.
+var bucket = []byte("speakerbob")
+
+type Store struct {
+	DB *bolt.DB
+}
+
+func (b Store) Get(key store.Key) ([]byte, error) {
+	var rval []byte
+
+	err := b.DB.View(func(tx *bolt.Tx) error {
+		val := tx.Bucket(bucket).Get(key.Bytes())
+		if val == nil {
+			return storage.ErrNotFound
+		}
+
+		// values are only valid during the transaction
+		rval = append([]byte{}, val...)
+
+		return nil
+	})
+
+	return rval, err
+}
+
+func (b Store) List(prefix store.TypeKey, process func([]byte) error) error {
+	return b.DB.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucket).Cursor()
+
+		for k, v := c.Seek(prefix.Bytes()); k != nil && bytes.HasPrefix(k, prefix.Bytes()); k, v = c.Next() {
+			// ignore field keys
+			if k[len(k)-1] != byte(store.ObjectKeySuffix) {
+				continue
+			}
+
+			if err := process(v); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (b Store) ReadLazy(key store.FieldKey, w io.Writer) error {
+	return b.DB.View(func(tx *bolt.Tx) error {
+		val := tx.Bucket(bucket).Get(key.Bytes())
+		if val == nil {
+			return storage.ErrNotFound
+		}
+
+		_, err := w.Write(val)
+
+		return err
+	})
+}
+
+func (b Store) WriteLazy(key store.FieldKey, r io.Reader) error {
+	// read outside of the transaction, bolt allows a single writer
+	val, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	return b.DB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put(key.Bytes(), val)
+	})
+}
+
+func (b Store) Save(key store.Key, bytes []byte) error {
+	return b.BulkSave(map[store.Key][]byte{key: bytes})
+}
+
+func (b Store) BulkSave(m map[store.Key][]byte) error {
+	return b.DB.Update(func(tx *bolt.Tx) error {
+		for k, v := range m {
+			if err := tx.Bucket(bucket).Put(k.Bytes(), v); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (b Store) Delete(keys ...store.Key) error {
+	return b.DB.Update(func(tx *bolt.Tx) error {
+		for i := range keys {
+			if err := tx.Bucket(bucket).Delete(keys[i].Bytes()); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (b Store) Close() error {
+	return b.DB.Close()
+}
@@ -0,0 +1,33 @@
+package boltdb
+
+import (
+	"errors"
+	"github.com/paynejacob/hotcereal/pkg/store"
+	"github.com/paynejacob/speakerbob/pkg/storage"
+	"github.com/paynejacob/speakerbob/pkg/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) store.Store {
+		s, err := Open(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = s.Close() })
+
+		return s
+	})
+}
+
+func TestOpen(t *testing.T) {
+	path := t.TempDir()
+
+	s, err := Open(path)
+	assert.NoError(t, err)
+	defer s.Close()
+
+	_, err = Open(path)
+	assert.True(t, errors.Is(err, storage.ErrLocked))
+}
@@ -0,0 +1,194 @@
+package redisdb
+
+import (
+	"errors"
+	"github.com/paynejacob/hotcereal/pkg/store"
+	"github.com/paynejacob/speakerbob/pkg/redis"
+	"github.com/paynejacob/speakerbob/pkg/storage"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// keys read per SCAN and MGET while listing
+const listBatchSize = 500
+
+// Store keeps every key in a redis compatible server so every replica of a cluster sees the same data.
+type Store struct {
+	Client *redis.Client
+}
+
+// Open connects to the server and checks it is reachable.
+func Open(options redis.Options) (Store, error) {
+	client := redis.NewClient(options)
+
+	if _, err := client.Do("PING"); err != nil {
+		_ = client.Close()
+		return Store{}, err
+	}
+
+	return Store{Client: client}, nil
+}
+
+func (s Store) Get(key store.Key) ([]byte, error) {
+	reply, err := s.Client.Do("GET", string(key.Bytes()))
+	if errors.Is(err, redis.ErrNil) {
+		return nil, storage.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	value, _ := reply.([]byte)
+
+	return value, nil
+}
+
+func (s Store) List(prefix store.TypeKey, process func([]byte) error) error {
+	cursor := "0"
+	pattern := escapePattern(string(prefix.Bytes())) + "*"
+
+	for {
+		reply, err := s.Client.Do("SCAN", cursor, "MATCH", pattern, "COUNT", strconv.Itoa(listBatchSize))
+		if err != nil {
+			return err
+		}
+
+		// replies are [next cursor, [keys...]]
+		values, ok := reply.([]interface{})
+		if !ok || len(values) != 2 {
+			return errors.New("redis: invalid scan reply")
+		}
+
+		next, _ := values[0].([]byte)
+		found, _ := values[1].([]interface{})
+
+		// ignore field keys
+		keys := make([]string, 0, len(found))
+		for i := range found {
+			key, _ := found[i].([]byte)
+			if len(key) > 0 && key[len(key)-1] == byte(store.ObjectKeySuffix) {
+				keys = append(keys, string(key))
+			}
+		}
+
+		for len(keys) > 0 {
+			n := len(keys)
+			if n > listBatchSize {
+				n = listBatchSize
+			}
+
+			if err = s.process(keys[:n], process); err != nil {
+				return err
+			}
+
+			keys = keys[n:]
+		}
+
+		cursor = string(next)
+		if cursor == "0" || cursor == "" {
+			return nil
+		}
+	}
+}
+
+// process reads keys and passes their values to process, keys deleted since they were listed are skipped.
+func (s Store) process(keys []string, process func([]byte) error) error {
+	reply, err := s.Client.Do(append([]string{"MGET"}, keys...)...)
+	if err != nil {
+		return err
+	}
+
+	values, _ := reply.([]interface{})
+	for i := range values {
+		value, ok := values[i].([]byte)
+		if !ok {
+			continue
+		}
+
+		if err = process(value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s Store) ReadLazy(key store.FieldKey, w io.Writer) error {
+	value, err := s.Get(key)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(value)
+
+	return err
+}
+
+func (s Store) WriteLazy(key store.FieldKey, r io.Reader) error {
+	value, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	return s.Save(key, value)
+}
+
+func (s Store) Save(key store.Key, bytes []byte) error {
+	_, err := s.Client.Do("SET", string(key.Bytes()), string(bytes))
+
+	return err
+}
+
+func (s Store) BulkSave(m map[store.Key][]byte) error {
+	if len(m) == 0 {
+		return nil
+	}
+
+	args := make([]string, 0, 1+2*len(m))
+	args = append(args, "MSET")
+	for k, v := range m {
+		args = append(args, string(k.Bytes()), string(v))
+	}
+
+	_, err := s.Client.Do(args...)
+
+	return err
+}
+
+func (s Store) Delete(keys ...store.Key) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	args := make([]string, 0, 1+len(keys))
+	args = append(args, "DEL")
+	for i := range keys {
+		args = append(args, string(keys[i].Bytes()))
+	}
+
+	_, err := s.Client.Do(args...)
+
+	return err
+}
+
+func (s Store) Close() error {
+	return s.Client.Close()
+}
+
+// escapePattern escapes the characters SCAN treats as wildcards.
+func escapePattern(s string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
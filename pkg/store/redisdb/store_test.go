@@ -0,0 +1,26 @@
+package redisdb
+
+import (
+	"github.com/paynejacob/hotcereal/pkg/store"
+	"github.com/paynejacob/speakerbob/pkg/redis"
+	"github.com/paynejacob/speakerbob/pkg/redis/redistest"
+	"github.com/paynejacob/speakerbob/pkg/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) store.Store {
+		s, err := Open(redis.Options{Address: redistest.NewServer(t).Address})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = s.Close() })
+
+		return s
+	})
+}
+
+func TestEscapePattern(t *testing.T) {
+	assert.Equal(t, `a\*b\?c\[d\]\\`, escapePattern(`a*b?c[d]\`))
+}
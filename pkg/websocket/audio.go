@@ -0,0 +1,173 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+	"github.com/vmihailenco/msgpack/v5"
+	"io"
+	"strconv"
+	"time"
+)
+
+const (
+	// query parameter clients use to receive audio over the websocket
+	streamAudioParameterName = "stream_audio"
+
+	audioContentType = "audio/mpeg"
+
+	// number of sounds kept in memory for streaming
+	audioCacheSize = 32
+)
+
+// AudioMessage is implemented by messages that need a sound's audio to be useful. Connections streaming audio
+// receive the audio before the message.
+type AudioMessage interface {
+	AudioId() string
+}
+
+// AudioSource writes the audio with the given id to w.
+type AudioSource func(id string, w io.Writer) error
+
+// AudioHeaderMessage precedes the binary frame holding the audio. The audio for an id never changes so clients
+// can cache it by sound id. Msgpack connections receive the audio in the data field instead of a separate frame.
+type AudioHeaderMessage struct {
+	Type        MessageType `json:"type"`
+	SoundId     string      `json:"sound_id"`
+	ContentType string      `json:"content_type"`
+	Size        int         `json:"size"`
+}
+
+func (m AudioHeaderMessage) MessageType() MessageType { return m.Type }
+
+// streamAudioCommand enables or disables audio streaming, cached lists the sounds the client already has.
+type streamAudioCommand struct {
+	Enabled bool     `json:"enabled"`
+	Cached  []string `json:"cached"`
+}
+
+// audioFrame queues the audio of a sound for a connection, the audio is read when the frame is written.
+type audioFrame struct {
+	soundId string
+}
+
+// RegisterAudioSource sets where audio is read from for connections streaming audio.
+func (s *Service) RegisterAudioSource(source AudioSource) {
+	s.audioM.Lock()
+	s.audioSource = source
+	s.audioM.Unlock()
+}
+
+// audio returns the audio for id, reading it from the audio source if it is not cached.
+func (s *Service) audio(id string) ([]byte, bool) {
+	var buf bytes.Buffer
+
+	s.audioM.Lock()
+	defer s.audioM.Unlock()
+
+	if data, ok := s.audioCache[id]; ok {
+		return data, true
+	}
+
+	if s.audioSource == nil {
+		return nil, false
+	}
+
+	if err := s.audioSource(id, &buf); err != nil {
+		logrus.Errorf("[websocket.audio] failed to read audio for %s: %v", id, err)
+		return nil, false
+	}
+
+	if s.audioCache == nil {
+		s.audioCache = make(map[string][]byte, audioCacheSize)
+	}
+
+	s.audioCache[id] = buf.Bytes()
+	s.audioOrder = append(s.audioOrder, id)
+	if len(s.audioOrder) > audioCacheSize {
+		delete(s.audioCache, s.audioOrder[0])
+		s.audioOrder = s.audioOrder[1:]
+	}
+
+	return buf.Bytes(), true
+}
+
+// writeAudio sends the audio header followed by the audio as a binary frame. Msgpack connections receive a single
+// message with the audio as binary data so frames are not ambiguous.
+func (c *Conn) writeAudio(frame audioFrame) error {
+	data, ok := c.service.audio(frame.soundId)
+	if !ok {
+		return nil
+	}
+
+	// reading the audio may have used up the write deadline
+	_ = c.ws.SetWriteDeadline(time.Now().Add(writeWait))
+
+	header := AudioHeaderMessage{
+		Type:        AudioMessageType,
+		SoundId:     frame.soundId,
+		ContentType: audioContentType,
+		Size:        len(data),
+	}
+
+	if c.ws.Subprotocol() == msgpackSubprotocol {
+		data, err := msgpack.Marshal(map[string]interface{}{
+			"type":         header.Type,
+			"sound_id":     header.SoundId,
+			"content_type": header.ContentType,
+			"size":         header.Size,
+			"data":         data,
+		})
+		if err != nil {
+			return err
+		}
+
+		return c.ws.WriteMessage(websocket.BinaryMessage, data)
+	}
+
+	if err := c.ws.WriteJSON(header); err != nil {
+		return err
+	}
+
+	return c.ws.WriteMessage(websocket.BinaryMessage, data)
+}
+
+func (c *Conn) setStreamAudio(body json.RawMessage) error {
+	var request streamAudioCommand
+
+	if err := json.Unmarshal(body, &request); err != nil {
+		return err
+	}
+
+	c.m.Lock()
+
+	c.streamAudio = request.Enabled
+	for i := range request.Cached {
+		c.sentAudio[request.Cached[i]] = true
+	}
+
+	c.m.Unlock()
+
+	return nil
+}
+
+// needsAudio reports whether the audio for id should be sent to the connection, marking it as sent.
+func (c *Conn) needsAudio(id string) bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if !c.streamAudio || c.sentAudio[id] {
+		return false
+	}
+
+	c.sentAudio[id] = true
+
+	return true
+}
+
+func parseStreamAudio(value string) bool {
+	streamAudio, _ := strconv.ParseBool(value)
+
+	return streamAudio
+}
@@ -0,0 +1,67 @@
+package websocket
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"time"
+)
+
+// ScheduledMessage is implemented by messages that tell clients when to act. Each connection receives a copy
+// adjusted for its clock offset.
+type ScheduledMessage interface {
+	WithClockOffset(offset time.Duration) interface{}
+}
+
+// clockSyncCommand starts an ntp style exchange, times are unix milliseconds.
+type clockSyncCommand struct {
+	ClientTime int64 `json:"client_time"`
+}
+
+// clockSyncResponse lets the client compute how far its clock is ahead of ours as ((client_time - server_receive) +
+// (client_receive - server_transmit)) / 2 and the round trip as (client_receive - client_time) -
+// (server_transmit - server_receive).
+type clockSyncResponse struct {
+	ClientTime     int64 `json:"client_time"`
+	ServerReceive  int64 `json:"server_receive"`
+	ServerTransmit int64 `json:"server_transmit"`
+}
+
+// clockOffsetCommand reports the offset the client computed, positive when the client's clock is ahead of ours.
+type clockOffsetCommand struct {
+	Offset int64 `json:"offset"`
+}
+
+func clockSync(received time.Time, body json.RawMessage) (interface{}, error) {
+	var request clockSyncCommand
+
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, err
+	}
+
+	return clockSyncResponse{
+		ClientTime:     request.ClientTime,
+		ServerReceive:  unixMilli(received),
+		ServerTransmit: unixMilli(time.Now()),
+	}, nil
+}
+
+func (c *Conn) setClockOffset(body json.RawMessage) error {
+	var request clockOffsetCommand
+
+	if err := json.Unmarshal(body, &request); err != nil {
+		return err
+	}
+
+	atomic.StoreInt64(&c.clockOffset, int64(time.Duration(request.Offset)*time.Millisecond))
+
+	return nil
+}
+
+// ClockOffset returns how far the client's clock is ahead of ours.
+func (c *Conn) ClockOffset() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.clockOffset))
+}
+
+func unixMilli(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
@@ -0,0 +1,96 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+)
+
+const eventsChannel = "speakerbob.events"
+
+// event is a broadcast message sent to the other replicas.
+type event struct {
+	Type MessageType     `json:"type"`
+	Body json.RawMessage `json:"body"`
+}
+
+// remoteMessage is a message from another replica with a type that was not registered, it is sent to clients as is.
+type remoteMessage struct {
+	messageType MessageType
+	body        json.RawMessage
+}
+
+func (m remoteMessage) MessageType() MessageType { return m.messageType }
+
+func (m remoteMessage) MarshalJSON() ([]byte, error) { return m.body, nil }
+
+// RegisterMessage registers how messages of type t broadcast by other replicas are decoded. Messages are decoded
+// into the pointer newMessage returns so they behave like messages broadcast by this replica.
+func (s *Service) RegisterMessage(t MessageType, newMessage func() Message) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.messageTypes == nil {
+		s.messageTypes = map[MessageType]func() Message{}
+	}
+
+	s.messageTypes[t] = newMessage
+}
+
+// replicaLocal messages describe the connections of a single replica, they are not sent to other replicas.
+func replicaLocal(messageType MessageType) bool {
+	switch messageType {
+	case ConnectionCountMessageType, PresenceJoinMessageType, PresenceLeaveMessageType:
+		return true
+	}
+
+	return false
+}
+
+// publish sends msg to every replica, this replica broadcasts it when it receives it back.
+func (s *Service) publish(msg Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(event{Type: msg.MessageType(), Body: body})
+	if err != nil {
+		return err
+	}
+
+	return s.Cluster.PubSub.Publish(eventsChannel, data)
+}
+
+// subscribe broadcasts the messages published by every replica until ctx is done.
+func (s *Service) subscribe(ctx context.Context) error {
+	return s.Cluster.PubSub.Subscribe(ctx, eventsChannel, func(data []byte) {
+		var e event
+
+		if err := json.Unmarshal(data, &e); err != nil {
+			logrus.Errorf("[websocket.subscribe] invalid event: %v", err)
+			return
+		}
+
+		s.broadcast(s.decode(e))
+	})
+}
+
+// decode returns the message an event holds, messages with an unregistered type are passed through.
+func (s *Service) decode(e event) Message {
+	s.m.RLock()
+	newMessage, ok := s.messageTypes[e.Type]
+	s.m.RUnlock()
+
+	if !ok {
+		return remoteMessage{messageType: e.Type, body: e.Body}
+	}
+
+	msg := newMessage()
+	if err := json.Unmarshal(e.Body, msg); err != nil {
+		logrus.Errorf("[websocket.decode] invalid %s message: %v", e.Type, err)
+		return remoteMessage{messageType: e.Type, body: e.Body}
+	}
+
+	return msg
+}
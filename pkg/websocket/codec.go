@@ -0,0 +1,68 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	// subprotocols clients can request with the Sec-WebSocket-Protocol header, connections without a subprotocol
+	// use json.
+	jsonSubprotocol    = "json"
+	msgpackSubprotocol = "msgpack"
+)
+
+// toMsgpack encodes msg as msgpack with the same structure as its json encoding. Stored types implement their own
+// msgpack encoding, so messages are encoded through json to keep the wire format identical between protocols.
+func toMsgpack(msg interface{}) ([]byte, error) {
+	var v interface{}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	if err = decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	return msgpack.Marshal(normalizeNumbers(v))
+}
+
+// msgpackToJSON converts a msgpack encoded command to json so it can be dispatched like any other command.
+func msgpackToJSON(data []byte) ([]byte, error) {
+	var v interface{}
+
+	if err := msgpack.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(v)
+}
+
+// normalizeNumbers replaces json numbers with integers where possible, so they are not encoded as floats.
+func normalizeNumbers(v interface{}) interface{} {
+	switch value := v.(type) {
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i
+		}
+
+		f, _ := value.Float64()
+		return f
+	case map[string]interface{}:
+		for k := range value {
+			value[k] = normalizeNumbers(value[k])
+		}
+	case []interface{}:
+		for i := range value {
+			value[i] = normalizeNumbers(value[i])
+		}
+	}
+
+	return v
+}
@@ -0,0 +1,126 @@
+package websocket
+
+import (
+	"encoding/json"
+	"github.com/paynejacob/speakerbob/pkg/auth"
+	"github.com/paynejacob/speakerbob/pkg/service"
+	"time"
+)
+
+type CommandType string
+
+const (
+	PingCommandType        CommandType = "ping"
+	SubscribeCommandType   CommandType = "subscribe"
+	ClockSyncCommandType   CommandType = "clock_sync"
+	ClockOffsetCommandType CommandType = "clock_offset"
+	StreamAudioCommandType CommandType = "stream_audio"
+	PlaySoundCommandType   CommandType = "play_sound"
+	PlayGroupCommandType   CommandType = "play_group"
+	SayCommandType         CommandType = "say"
+	QueueCommandType       CommandType = "queue"
+	ClearQueueCommandType  CommandType = "clear_queue"
+	PlaybackCommandType    CommandType = "playback"
+)
+
+// CommandMessage is the envelope for every message a client sends over the websocket.
+type CommandMessage struct {
+	Id   string          `json:"id"`
+	Type CommandType     `json:"type"`
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+// CommandHandler processes the body of a command, the returned value is sent to the client in the ack.
+type CommandHandler func(conn *Conn, body json.RawMessage) (interface{}, error)
+
+type command struct {
+	permission auth.Permission
+	handler    CommandHandler
+}
+
+type pingResponse struct {
+	Time time.Time `json:"time"`
+}
+
+// RegisterCommand routes commands of the given type to handler. Unauthenticated connections must be granted
+// permission to send the command.
+func (s *Service) RegisterCommand(commandType CommandType, permission auth.Permission, handler CommandHandler) {
+	s.m.Lock()
+
+	if s.commands == nil {
+		s.commands = map[CommandType]command{}
+	}
+
+	s.commands[commandType] = command{permission: permission, handler: handler}
+
+	s.m.Unlock()
+}
+
+func (s *Service) dispatch(conn *Conn, data []byte) {
+	var err error
+	var msg CommandMessage
+	var body interface{}
+
+	received := time.Now()
+
+	if err = json.Unmarshal(data, &msg); err != nil {
+		conn.reply(ErrorMessage{Type: ErrorMessageType, Message: "unable to parse message"})
+		return
+	}
+
+	switch msg.Type {
+	case PingCommandType:
+		body = pingResponse{Time: time.Now()}
+	case SubscribeCommandType:
+		var request Subscription
+
+		if err = json.Unmarshal(msg.Body, &request); err != nil {
+			conn.reply(ErrorMessage{Type: ErrorMessageType, Id: msg.Id, Message: "unable to parse message body"})
+			return
+		}
+
+		conn.Subscribe(request)
+	case ClockSyncCommandType:
+		if body, err = clockSync(received, msg.Body); err != nil {
+			conn.reply(ErrorMessage{Type: ErrorMessageType, Id: msg.Id, Message: "unable to parse message body"})
+			return
+		}
+	case ClockOffsetCommandType:
+		if err = conn.setClockOffset(msg.Body); err != nil {
+			conn.reply(ErrorMessage{Type: ErrorMessageType, Id: msg.Id, Message: "unable to parse message body"})
+			return
+		}
+	case StreamAudioCommandType:
+		if conn.ws == nil {
+			conn.reply(ErrorMessage{Type: ErrorMessageType, Id: msg.Id, Message: "audio can only be streamed over websockets"})
+			return
+		}
+
+		if err = conn.setStreamAudio(msg.Body); err != nil {
+			conn.reply(ErrorMessage{Type: ErrorMessageType, Id: msg.Id, Message: "unable to parse message body"})
+			return
+		}
+	default:
+		s.m.RLock()
+		cmd, ok := s.commands[msg.Type]
+		s.m.RUnlock()
+
+		if !ok {
+			conn.reply(ErrorMessage{Type: ErrorMessageType, Id: msg.Id, Message: "unknown command type: " + string(msg.Type)})
+			return
+		}
+
+		if conn.token == nil && !s.AuthService.GuestAllowed(cmd.permission) {
+			conn.reply(ErrorMessage{Type: ErrorMessageType, Id: msg.Id, Message: "permission denied"})
+			return
+		}
+
+		body, err = cmd.handler(conn, msg.Body)
+		if err != nil {
+			conn.reply(ErrorMessage{Type: ErrorMessageType, Id: msg.Id, Message: service.ErrorMessage(err)})
+			return
+		}
+	}
+
+	conn.reply(AckMessage{Type: AckMessageType, Id: msg.Id, Body: body})
+}
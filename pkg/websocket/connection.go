@@ -1,37 +1,153 @@
 package websocket
 
 import (
+	"expvar"
 	"github.com/gorilla/websocket"
+	"github.com/paynejacob/speakerbob/pkg/auth"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
+	// Time allowed to write a message to the peer.
+	writeWait = 10 * time.Second
+
 	// Time allowed to read the next pong message from the peer.
 	pongWait = 60 * time.Second
 
 	// Send pings to peer with this period. Must be less than pongWait.
 	pingPeriod = (pongWait * 9) / 10
 
-	// Maximum message size allowed from peer.
-	maxMessageSize = 512
+	// Maximum message size allowed from peer, large enough for a stream_audio command listing the cached sounds.
+	maxMessageSize = 16 * 1024
 
 	// max messages to buffer per connection
 	sendChannelSize = 256
 )
 
+var (
+	droppedMessages    = expvar.NewInt("websocket_dropped_messages")
+	evictedConnections = expvar.NewInt("websocket_evicted_connections")
+	writeErrors        = expvar.NewInt("websocket_write_errors")
+)
+
 type Conn struct {
-	ws *websocket.Conn
+	ws       *websocket.Conn
+	token    *auth.Token
+	presence Presence
 
 	service *Service
 	send    chan interface{}
+	done    chan struct{}
+
+	m            sync.RWMutex
+	subscription *subscriptionFilter
+	streamAudio  bool
+	sentAudio    map[string]bool
+
+	evicted     int32
+	clockOffset int64
 }
 
-func NewConn(ws *websocket.Conn, service *Service) *Conn {
-	return &Conn{ws: ws, service: service, send: make(chan interface{}, sendChannelSize)}
+func NewConn(ws *websocket.Conn, service *Service, token *auth.Token) *Conn {
+	return &Conn{
+		ws:        ws,
+		token:     token,
+		service:   service,
+		send:      make(chan interface{}, sendChannelSize),
+		done:      make(chan struct{}),
+		sentAudio: map[string]bool{},
+	}
 }
 
+// SendMessage queues msg for the connection, messages the connection has not subscribed to are dropped.
 func (c *Conn) SendMessage(msg interface{}) {
-	c.send <- msg
+	if m, ok := msg.(Message); ok && !c.subscribed(m.MessageType()) {
+		return
+	}
+
+	if m, ok := msg.(ScheduledMessage); ok {
+		msg = m.WithClockOffset(c.ClockOffset())
+	}
+
+	// the audio is read by the write pump, broadcasts hold the service lock
+	if m, ok := msg.(AudioMessage); ok && c.needsAudio(m.AudioId()) {
+		c.enqueue(audioFrame{soundId: m.AudioId()})
+	}
+
+	c.enqueue(msg)
+}
+
+// Token returns the token the connection authenticated with, nil for guest connections.
+func (c *Conn) Token() *auth.Token {
+	return c.token
+}
+
+// Presence returns who is listening on the connection.
+func (c *Conn) Presence() Presence {
+	return c.presence
+}
+
+func (c *Conn) reply(msg interface{}) {
+	c.enqueue(msg)
+}
+
+// enqueue never blocks, connections that can not keep up with their messages are evicted.
+func (c *Conn) enqueue(msg interface{}) {
+	if atomic.LoadInt32(&c.evicted) == 1 {
+		droppedMessages.Add(1)
+		return
+	}
+
+	select {
+	case c.send <- msg:
+	default:
+		droppedMessages.Add(1)
+		c.evict()
+	}
+}
+
+// evict closes the connection, whatever is serving the connection unregisters it once it is closed.
+func (c *Conn) evict() {
+	if !atomic.CompareAndSwapInt32(&c.evicted, 0, 1) {
+		return
+	}
+
+	evictedConnections.Add(1)
+	logrus.Debugf("evicting slow connection: %s", c.presence.Id)
+
+	close(c.done)
+
+	if c.ws != nil {
+		_ = c.ws.Close()
+	}
+}
+
+// Subscribe limits the messages sent to the connection, an empty subscription receives every message.
+func (c *Conn) Subscribe(subscription Subscription) {
+	filter := newSubscriptionFilter(subscription)
+
+	c.m.Lock()
+	c.subscription = filter
+	c.m.Unlock()
+}
+
+func (c *Conn) subscribed(messageType MessageType) bool {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	return c.subscription.allows(messageType)
+}
+
+func (c *Conn) closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
 }
 
 func (c *Conn) readPump() {
@@ -45,13 +161,40 @@ func (c *Conn) readPump() {
 	c.ws.SetPongHandler(func(string) error { return c.ws.SetReadDeadline(time.Now().Add(pongWait)) })
 
 	for {
-		_, _, err := c.ws.ReadMessage()
+		messageType, data, err := c.ws.ReadMessage()
 		if err != nil {
 			break
 		}
+
+		if messageType == websocket.BinaryMessage {
+			if data, err = msgpackToJSON(data); err != nil {
+				c.reply(ErrorMessage{Type: ErrorMessageType, Message: "unable to parse message"})
+				continue
+			}
+		}
+
+		c.service.dispatch(c, data)
 	}
 }
 
+// write encodes message with the subprotocol negotiated for the connection.
+func (c *Conn) write(message interface{}) error {
+	if frame, ok := message.(audioFrame); ok {
+		return c.writeAudio(frame)
+	}
+
+	if c.ws.Subprotocol() != msgpackSubprotocol {
+		return c.ws.WriteJSON(message)
+	}
+
+	data, err := toMsgpack(message)
+	if err != nil {
+		return err
+	}
+
+	return c.ws.WriteMessage(websocket.BinaryMessage, data)
+}
+
 func (c *Conn) writePump() {
 	ticker := time.NewTicker(pingPeriod)
 	defer func() {
@@ -62,8 +205,13 @@ func (c *Conn) writePump() {
 	for {
 		select {
 		case message := <-c.send:
-			_ = c.ws.WriteJSON(message)
+			_ = c.ws.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.write(message); err != nil {
+				writeErrors.Add(1)
+				return
+			}
 		case <-ticker.C:
+			_ = c.ws.SetWriteDeadline(time.Now().Add(writeWait))
 			if err := c.ws.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
@@ -0,0 +1,334 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/paynejacob/speakerbob/pkg/auth"
+	"github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// query parameter long poll clients use to continue their session
+	cursorParameterName = "cursor"
+
+	// Time a long poll waits for messages. Must be less than the http server's write timeout.
+	longPollTimeout = 8 * time.Second
+
+	// Long poll sessions that are not polled within this time are closed.
+	pollTTL = 30 * time.Second
+
+	pollCleanupInterval = 10 * time.Second
+)
+
+// events streams messages to clients that can not use websockets as server sent events.
+func (s *Service) events(w http.ResponseWriter, r *http.Request) {
+	token, ok := s.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	since, replay, err := parseSince(r)
+	if err != nil {
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+
+	stream, err := newEventStream(w)
+	if err != nil {
+		logrus.Errorf("[websocket.events] failed to open event stream: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer stream.Close()
+
+	conn := s.newConn(nil, r, token)
+
+	s.registerConnection(conn, since, replay)
+	defer s.unRegisterConnection(conn)
+
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case msg := <-conn.send:
+			err = stream.WriteMessage(msg)
+		case <-ticker.C:
+			err = stream.WriteComment("ping")
+		case <-conn.done:
+			return
+		case <-stream.closed:
+			return
+		case <-r.Context().Done():
+			return
+		}
+
+		if err != nil {
+			writeErrors.Add(1)
+			return
+		}
+	}
+}
+
+// eventStream writes server sent events. When possible the connection is hijacked so the stream is not cut off
+// by the http server's write timeout.
+type eventStream struct {
+	conn    net.Conn
+	w       *bufio.Writer
+	flusher http.Flusher
+
+	// closed is closed when the client disconnects from a hijacked connection, the request context is not canceled
+	// once the connection is hijacked.
+	closed chan struct{}
+}
+
+// hijackedHeaders are the headers set by middleware that are kept when the connection is hijacked, the cors
+// middleware sets them before the handler runs.
+var hijackedHeaders = []string{
+	"Access-Control-Allow-Origin",
+	"Access-Control-Allow-Credentials",
+	"Access-Control-Expose-Headers",
+	"Vary",
+}
+
+func newEventStream(w http.ResponseWriter) (*eventStream, error) {
+	if hijacker, ok := w.(http.Hijacker); ok {
+		conn, buf, err := hijacker.Hijack()
+		if err != nil {
+			return nil, err
+		}
+
+		stream := &eventStream{conn: conn, w: buf.Writer, closed: make(chan struct{})}
+
+		_ = conn.SetDeadline(time.Time{})
+		_, _ = stream.w.WriteString("HTTP/1.1 200 OK\r\n" +
+			"Content-Type: text/event-stream\r\n" +
+			"Cache-Control: no-cache\r\n" +
+			"X-Accel-Buffering: no\r\n" +
+			"Connection: close\r\n")
+		for _, name := range hijackedHeaders {
+			for _, value := range w.Header().Values(name) {
+				_, _ = fmt.Fprintf(stream.w, "%s: %s\r\n", name, value)
+			}
+		}
+		_, _ = stream.w.WriteString("\r\n")
+
+		if err = stream.flush(); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+
+		go stream.watch(buf.Reader)
+
+		return stream, nil
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("streaming is not supported")
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	stream := &eventStream{w: bufio.NewWriter(w), flusher: flusher}
+
+	return stream, stream.flush()
+}
+
+// watch closes closed when reading from the client fails, clients send nothing after the request so any read
+// error means they disconnected.
+func (e *eventStream) watch(r *bufio.Reader) {
+	defer close(e.closed)
+
+	_, _ = io.Copy(ioutil.Discard, r)
+}
+
+// WriteMessage writes msg as an event, sequenced messages use their epoch and sequence number as the event id.
+func (e *eventStream) WriteMessage(msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	if m, ok := msg.(SequencedMessage); ok {
+		_, _ = fmt.Fprintf(e.w, "id: %s:%d\n", m.Epoch, m.Seq)
+	}
+
+	_, _ = fmt.Fprintf(e.w, "data: %s\n\n", data)
+
+	return e.flush()
+}
+
+// WriteComment writes a comment, clients ignore comments so they are used to keep the connection open.
+func (e *eventStream) WriteComment(comment string) error {
+	_, _ = fmt.Fprintf(e.w, ": %s\n\n", comment)
+
+	return e.flush()
+}
+
+func (e *eventStream) Close() error {
+	if e.conn == nil {
+		return nil
+	}
+
+	return e.conn.Close()
+}
+
+func (e *eventStream) flush() error {
+	if e.conn != nil {
+		_ = e.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	}
+
+	if err := e.w.Flush(); err != nil {
+		return err
+	}
+
+	if e.flusher != nil {
+		e.flusher.Flush()
+	}
+
+	return nil
+}
+
+// poll is a long poll session, messages are buffered in the connection between polls.
+type poll struct {
+	conn     *Conn
+	cursor   string
+	lastPoll int64
+}
+
+type pollResponse struct {
+	Cursor   string        `json:"cursor"`
+	Messages []interface{} `json:"messages"`
+}
+
+func (p *poll) touch() {
+	atomic.StoreInt64(&p.lastPoll, time.Now().UnixNano())
+}
+
+func (p *poll) expired(now time.Time) bool {
+	return now.Sub(time.Unix(0, atomic.LoadInt64(&p.lastPoll))) > pollTTL || p.conn.closed()
+}
+
+// wait returns the buffered messages, if there are none it waits for the next message or the timeout.
+func (p *poll) wait(ctx context.Context, timeout time.Duration) []interface{} {
+	messages := make([]interface{}, 0)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case msg := <-p.conn.send:
+		messages = append(messages, msg)
+	case <-timer.C:
+		return messages
+	case <-p.conn.done:
+		return messages
+	case <-ctx.Done():
+		return messages
+	}
+
+	for {
+		select {
+		case msg := <-p.conn.send:
+			messages = append(messages, msg)
+		default:
+			return messages
+		}
+	}
+}
+
+// poll serves messages to clients that can not hold a connection open. The first request opens a session and
+// returns its cursor, following requests pass the cursor to receive the messages broadcast since their last poll.
+func (s *Service) poll(w http.ResponseWriter, r *http.Request) {
+	var p *poll
+
+	token, ok := s.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	if cursor := r.URL.Query().Get(cursorParameterName); cursor != "" {
+		s.m.RLock()
+		p = s.polls[cursor]
+		s.m.RUnlock()
+
+		// the session expired or belongs to someone else, the client must open a new session
+		if p == nil || p.conn.closed() || !sameUser(p.conn.token, token) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	} else {
+		since, replay, err := parseSince(r)
+		if err != nil {
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+
+		p = &poll{
+			conn:   s.newConn(nil, r, token),
+			cursor: strings.Replace(uuid.New().String(), "-", "", 4),
+		}
+		p.touch()
+
+		s.m.Lock()
+		if s.polls == nil {
+			s.polls = map[string]*poll{}
+		}
+		s.polls[p.cursor] = p
+		s.m.Unlock()
+
+		s.registerConnection(p.conn, since, replay)
+	}
+
+	p.touch()
+	resp := pollResponse{Cursor: p.cursor, Messages: p.wait(r.Context(), longPollTimeout)}
+	p.touch()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logrus.Errorf("[websocket.poll] failed to encode messages: %v", err)
+	}
+}
+
+// expirePolls closes long poll sessions that are no longer being polled.
+func (s *Service) expirePolls() {
+	var expired []*poll
+
+	now := time.Now()
+
+	s.m.Lock()
+	for cursor, p := range s.polls {
+		if p.expired(now) {
+			expired = append(expired, p)
+			delete(s.polls, cursor)
+		}
+	}
+	s.m.Unlock()
+
+	for i := range expired {
+		s.unRegisterConnection(expired[i].conn)
+	}
+}
+
+func sameUser(a, b *auth.Token) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.UserId == b.UserId
+}
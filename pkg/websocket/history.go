@@ -0,0 +1,107 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"strconv"
+	"strings"
+)
+
+// max number of sequenced messages kept for reconnecting clients, must be less than sendChannelSize
+const historySize = 128
+
+// SequencedMessage is a broadcast message with its position in the event stream.
+type SequencedMessage struct {
+	Epoch string
+	Seq   uint64
+	Message
+}
+
+// MarshalJSON encodes the epoch and sequence number alongside the fields of the message.
+func (m SequencedMessage) MarshalJSON() ([]byte, error) {
+	body, err := json.Marshal(m.Message)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(body) < 2 || body[0] != '{' {
+		return nil, errors.New("sequenced messages must encode to a json object")
+	}
+
+	epoch, _ := json.Marshal(m.Epoch)
+
+	rval := []byte(`{"epoch":` + string(epoch) + `,"seq":` + strconv.FormatUint(m.Seq, 10))
+	if len(body) > 2 {
+		rval = append(rval, ',')
+	}
+
+	return append(rval, body[1:]...), nil
+}
+
+// position is a place in the event stream, sequence numbers are only comparable within an epoch.
+type position struct {
+	epoch string
+	seq   uint64
+}
+
+// history is a ring buffer of the most recent sequenced messages.
+type history struct {
+	messages [historySize]SequencedMessage
+	next     int
+	size     int
+	seq      uint64
+
+	// epoch identifies the history, every replica numbers the messages it broadcasts on its own and starts over when
+	// it restarts
+	epoch string
+}
+
+// last returns the position of the latest message.
+func (h *history) last() position {
+	if h.epoch == "" {
+		h.epoch = strings.Replace(uuid.New().String(), "-", "", 4)[:8]
+	}
+
+	return position{epoch: h.epoch, seq: h.seq}
+}
+
+// push assigns the next sequence number to msg and stores it.
+func (h *history) push(msg Message) SequencedMessage {
+	h.seq++
+
+	m := SequencedMessage{Epoch: h.last().epoch, Seq: h.seq, Message: msg}
+
+	h.messages[h.next] = m
+	h.next = (h.next + 1) % historySize
+	if h.size < historySize {
+		h.size++
+	}
+
+	return m
+}
+
+// since returns the messages after p, ok is false if messages after p are no longer available.
+func (h *history) since(p position) (messages []SequencedMessage, ok bool) {
+	// the client was numbered by another replica or before the server restarted
+	if p.epoch != h.last().epoch {
+		return nil, false
+	}
+
+	// the client is ahead of us
+	if p.seq > h.seq {
+		return nil, false
+	}
+
+	missed := int(h.seq - p.seq)
+	if missed > h.size {
+		return nil, false
+	}
+
+	messages = make([]SequencedMessage, 0, missed)
+	for i := missed; i > 0; i-- {
+		messages = append(messages, h.messages[(h.next-i+historySize)%historySize])
+	}
+
+	return messages, true
+}
@@ -4,15 +4,68 @@ type MessageType string
 
 const (
 	PlayMessageType            = "play"
+	CreateSoundMessageType     = "create_sound"
 	UpdateSoundMessageType     = "update_sound"
 	DeleteSoundMessageType     = "delete_sound"
 	CreateGroupMessageType     = "create_group"
 	UpdateGroupMessageType     = "update_group"
 	DeleteGroupMessageType     = "delete_group"
 	ConnectionCountMessageType = "connection_count"
+	AckMessageType             = "ack"
+	ErrorMessageType           = "error"
+	SequenceMessageType        = "sequence"
+	ResyncMessageType          = "resync_required"
+	PresenceJoinMessageType    = "presence_join"
+	PresenceLeaveMessageType   = "presence_leave"
+	AudioMessageType           = "audio"
 )
 
+// ephemeral messages are only relevant at the moment they are broadcast, they are not sequenced or replayed.
+func ephemeral(messageType MessageType) bool {
+	switch messageType {
+	case PlayMessageType, ConnectionCountMessageType, PresenceJoinMessageType, PresenceLeaveMessageType:
+		return true
+	}
+
+	return false
+}
+
+// Message is implemented by every message broadcast to connections.
+type Message interface {
+	MessageType() MessageType
+}
+
 type ConnectionCountMessage struct {
 	Type  MessageType `json:"type"`
 	Count int         `json:"count"`
 }
+
+func (m ConnectionCountMessage) MessageType() MessageType { return m.Type }
+
+// SequenceMessage tells a connection the epoch and sequence number of the latest broadcast message. When the type
+// is ResyncMessageType the messages the client asked to replay are gone and it must reload its state.
+type SequenceMessage struct {
+	Type  MessageType `json:"type"`
+	Epoch string      `json:"epoch"`
+	Seq   uint64      `json:"seq"`
+}
+
+func (m SequenceMessage) MessageType() MessageType { return m.Type }
+
+// AckMessage is sent in reply to a command that was processed successfully.
+type AckMessage struct {
+	Type MessageType `json:"type"`
+	Id   string      `json:"id"`
+	Body interface{} `json:"body,omitempty"`
+}
+
+func (m AckMessage) MessageType() MessageType { return m.Type }
+
+// ErrorMessage is sent in reply to a command that could not be processed.
+type ErrorMessage struct {
+	Type    MessageType `json:"type"`
+	Id      string      `json:"id,omitempty"`
+	Message string      `json:"message"`
+}
+
+func (m ErrorMessage) MessageType() MessageType { return m.Type }
@@ -0,0 +1,85 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/paynejacob/speakerbob/pkg/auth"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// query parameter clients use to identify what kind of client they are
+	clientParameterName = "client"
+	defaultClientType   = "unknown"
+)
+
+// Presence describes a single connection that is listening for messages.
+type Presence struct {
+	Id          string    `json:"id"`
+	UserId      string    `json:"user_id,omitempty"`
+	Name        string    `json:"name,omitempty"`
+	Client      string    `json:"client"`
+	ConnectedAt time.Time `json:"connected_at"`
+}
+
+type PresenceMessage struct {
+	Type     MessageType `json:"type"`
+	Presence Presence    `json:"presence"`
+}
+
+func (m PresenceMessage) MessageType() MessageType { return m.Type }
+
+func (s *Service) newPresence(r *http.Request, token *auth.Token) Presence {
+	p := Presence{
+		Id:          strings.Replace(uuid.New().String(), "-", "", 4),
+		Client:      r.URL.Query().Get(clientParameterName),
+		ConnectedAt: time.Now(),
+	}
+
+	if p.Client == "" {
+		p.Client = defaultClientType
+	}
+
+	if token != nil {
+		p.UserId = token.UserId
+
+		if user := s.AuthService.UserProvider.Get(token.UserId); user != nil {
+			p.Name = user.Name()
+		}
+	}
+
+	return p
+}
+
+// ListPresence returns the presence of every open connection.
+func (s *Service) ListPresence() []Presence {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	rval := make([]Presence, len(s.connections))
+	for i := range s.connections {
+		rval[i] = s.connections[i].presence
+	}
+
+	return rval
+}
+
+// PresenceService serves the presence of websocket connections over the api.
+type PresenceService struct {
+	WebsocketService *Service
+}
+
+func (s PresenceService) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/presence/", s.listPresence).Methods(http.MethodGet)
+}
+
+func (s PresenceService) Run(context.Context) {}
+
+func (s PresenceService) listPresence(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.WebsocketService.ListPresence())
+}
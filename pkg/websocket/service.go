@@ -2,70 +2,260 @@ package websocket
 
 import (
 	"context"
+	"errors"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 	"github.com/paynejacob/speakerbob/pkg/auth"
+	"github.com/paynejacob/speakerbob/pkg/cluster"
+	"github.com/sirupsen/logrus"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
+)
+
+const (
+	// query parameters clients use to replay messages they missed while disconnected
+	sinceParameterName = "since"
+	epochParameterName = "epoch"
+	lastEventIdHeader  = "Last-Event-ID"
 )
 
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true },
+	Subprotocols:      []string{jsonSubprotocol, msgpackSubprotocol},
+	EnableCompression: true,
 }
 
 type Service struct {
 	AuthService *auth.Service
 
-	m           sync.RWMutex
-	connections []*Conn
+	// AllowedOrigins are the origins other than our own that may open websockets, "*" allows any origin.
+	AllowedOrigins []string
+
+	// Cluster sends broadcast messages to the connections of every replica, messages are only sent to the
+	// connections of this replica if it is nil.
+	Cluster *cluster.Cluster
+
+	m            sync.RWMutex
+	connections  []*Conn
+	commands     map[CommandType]command
+	messageTypes map[MessageType]func() Message
+	history      history
+	polls        map[string]*poll
+
+	audioM      sync.Mutex
+	audioSource AudioSource
+	audioCache  map[string][]byte
+	audioOrder  []string
 }
 
 func (s *Service) RegisterRoutes(router *mux.Router) {
 	router.HandleFunc("/ws/", s.connect).Methods("GET")
+	router.HandleFunc("/events/", s.events).Methods(http.MethodGet)
+	router.HandleFunc("/events/poll/", s.poll).Methods(http.MethodGet)
 }
 
+// BroadcastMessage sends msg to every connection. Messages that are not ephemeral are assigned a sequence number
+// and kept so reconnecting clients can replay them.
 func (s *Service) BroadcastMessage(msg interface{}) {
-	s.m.RLock()
+	if m, ok := msg.(Message); ok && s.Cluster != nil && !replicaLocal(m.MessageType()) {
+		err := s.publish(m)
+		if err == nil {
+			return
+		}
+
+		// the other replicas miss the message but our connections still get it
+		logrus.Errorf("[websocket.BroadcastMessage] unable to publish message: %v", err)
+	}
+
+	s.broadcast(msg)
+}
+
+// broadcast sends msg to the connections of this replica.
+func (s *Service) broadcast(msg interface{}) {
+	s.m.Lock()
+
+	if m, ok := msg.(Message); ok && !ephemeral(m.MessageType()) {
+		msg = s.history.push(m)
+	}
 
 	for i := range s.connections {
 		s.connections[i].SendMessage(msg)
 	}
 
-	s.m.RUnlock()
+	s.m.Unlock()
+}
+
+// ConnectionCount returns the number of open connections.
+func (s *Service) ConnectionCount() int {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	return len(s.connections)
 }
 
-func (s *Service) Run(context.Context) {}
+func (s *Service) Run(ctx context.Context) {
+	if s.Cluster != nil {
+		if err := s.subscribe(ctx); err != nil {
+			logrus.Errorf("[websocket.Run] unable to receive messages from other replicas: %v", err)
+		}
+	}
+
+	ticker := time.NewTicker(pollCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.expirePolls()
+		}
+	}
+}
 
 func (s *Service) connect(w http.ResponseWriter, r *http.Request) {
-	if _, valid := s.AuthService.VerifyWebsocket(r); !valid {
-		w.WriteHeader(http.StatusUnauthorized)
+	token, ok := s.authorize(w, r)
+	if !ok {
 		return
 	}
 
-	ws, err := upgrader.Upgrade(w, r, nil)
+	since, replay, err := parseSince(r)
 	if err != nil {
+		w.WriteHeader(http.StatusNotAcceptable)
 		return
 	}
 
-	conn := NewConn(ws, s)
-	s.registerConnection(conn)
+	u := upgrader
+	u.CheckOrigin = s.checkOrigin
+
+	ws, err := u.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	conn := s.newConn(ws, r, token)
 
 	go conn.writePump()
+	s.registerConnection(conn, since, replay)
 	conn.readPump()
 }
 
-func (s *Service) registerConnection(conn *Conn) {
+// newConn creates a connection for the request with the presence and subscription the client asked for.
+func (s *Service) newConn(ws *websocket.Conn, r *http.Request, token *auth.Token) *Conn {
+	conn := NewConn(ws, s, token)
+	conn.presence = s.newPresence(r, token)
+	conn.Subscribe(parseSubscription(r))
+
+	// audio is sent as binary frames so it is only streamed over websockets
+	if ws != nil {
+		conn.streamAudio = parseStreamAudio(r.URL.Query().Get(streamAudioParameterName))
+	}
+
+	return conn
+}
+
+// authorize verifies the request may listen for messages, the returned token is nil for guests.
+func (s *Service) authorize(w http.ResponseWriter, r *http.Request) (*auth.Token, bool) {
+	token, valid := s.AuthService.VerifyWebsocket(r)
+	if valid {
+		return token, true
+	}
+
+	if !s.AuthService.GuestAllowed(auth.ListenPermission) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return nil, true
+}
+
+// checkOrigin prevents other sites from opening websockets with our users' cookies.
+func (s *Service) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	for i := range s.AllowedOrigins {
+		if s.AllowedOrigins[i] == "*" || strings.EqualFold(s.AllowedOrigins[i], origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseSince returns the position the client wants to resume from. The Last-Event-ID header is set by EventSource
+// clients when they reconnect, it is the id of the last event they received.
+func parseSince(r *http.Request) (since position, replay bool, err error) {
+	if id := r.Header.Get(lastEventIdHeader); id != "" {
+		i := strings.LastIndex(id, ":")
+		if i < 0 {
+			return since, false, errors.New("invalid event id")
+		}
+
+		since.epoch = id[:i]
+		since.seq, err = strconv.ParseUint(id[i+1:], 10, 64)
+
+		return since, err == nil, err
+	}
+
+	v := r.URL.Query().Get(sinceParameterName)
+	if v == "" {
+		return since, false, nil
+	}
+
+	since.epoch = r.URL.Query().Get(epochParameterName)
+	since.seq, err = strconv.ParseUint(v, 10, 64)
+
+	return since, err == nil, err
+}
+
+// registerConnection adds conn to the broadcast list. The messages conn missed since the given position are
+// replayed if requested, otherwise conn is told the current position.
+func (s *Service) registerConnection(conn *Conn, since position, replay bool) {
 	var connectionCount int
 
 	s.m.Lock()
 	s.connections = append(s.connections, conn)
 	connectionCount = len(s.connections)
+
+	last := s.history.last()
+
+	if replay {
+		if messages, ok := s.history.since(since); ok {
+			for i := range messages {
+				conn.SendMessage(messages[i])
+			}
+		} else {
+			conn.reply(SequenceMessage{Type: ResyncMessageType, Epoch: last.epoch, Seq: last.seq})
+		}
+	} else {
+		conn.reply(SequenceMessage{Type: SequenceMessageType, Epoch: last.epoch, Seq: last.seq})
+	}
 	s.m.Unlock()
 
 	s.BroadcastMessage(ConnectionCountMessage{
 		Type:  ConnectionCountMessageType,
 		Count: connectionCount,
 	})
+
+	s.BroadcastMessage(PresenceMessage{
+		Type:     PresenceJoinMessageType,
+		Presence: conn.presence,
+	})
 }
 
 func (s *Service) unRegisterConnection(conn *Conn) {
@@ -85,4 +275,9 @@ func (s *Service) unRegisterConnection(conn *Conn) {
 		Type:  ConnectionCountMessageType,
 		Count: connectionCount,
 	})
+
+	s.BroadcastMessage(PresenceMessage{
+		Type:     PresenceLeaveMessageType,
+		Presence: conn.presence,
+	})
 }
@@ -0,0 +1,740 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gavv/httpexpect/v2"
+	"github.com/gorilla/handlers"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/paynejacob/speakerbob/pkg/auth"
+	"github.com/paynejacob/speakerbob/pkg/cluster"
+	"github.com/paynejacob/speakerbob/pkg/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v5"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var svc *Service
+
+type testMessage struct {
+	Type MessageType `json:"type"`
+	Text string      `json:"text"`
+}
+
+func (m testMessage) MessageType() MessageType { return m.Type }
+
+func newServer() *httptest.Server {
+	svc = &Service{AuthService: &auth.Service{}}
+
+	router := mux.NewRouter()
+	svc.RegisterRoutes(router)
+
+	return httptest.NewServer(router)
+}
+
+func dial(t *testing.T, sut *httptest.Server, query string) *websocket.Conn {
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(sut.URL, "http")+"/ws/"+query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ws
+}
+
+// readMessage returns the next message that is not a connection count or presence change
+func readMessage(t *testing.T, ws *websocket.Conn) map[string]interface{} {
+	var msg map[string]interface{}
+
+	for {
+		msg = nil
+
+		_ = ws.SetReadDeadline(time.Now().Add(time.Second))
+		if err := ws.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+
+		switch msg["type"] {
+		case ConnectionCountMessageType, PresenceJoinMessageType, PresenceLeaveMessageType:
+			continue
+		}
+
+		return msg
+	}
+}
+
+func TestCommand(t *testing.T) {
+	sut := newServer()
+	defer sut.Close()
+
+	svc.RegisterCommand("echo", auth.PlayPermission, func(_ *Conn, body json.RawMessage) (interface{}, error) {
+		var text string
+
+		if err := json.Unmarshal(body, &text); err != nil {
+			return nil, service.NewNotAcceptableError("bad echo")
+		}
+
+		return text, nil
+	})
+
+	ws := dial(t, sut, "")
+	defer ws.Close()
+
+	msg := readMessage(t, ws)
+	assert.Equal(t, SequenceMessageType, msg["type"])
+
+	// ping
+	_ = ws.WriteJSON(CommandMessage{Id: "1", Type: PingCommandType})
+	msg = readMessage(t, ws)
+	assert.Equal(t, AckMessageType, msg["type"])
+	assert.Equal(t, "1", msg["id"])
+
+	// registered command
+	_ = ws.WriteJSON(CommandMessage{Id: "2", Type: "echo", Body: json.RawMessage(`"hello"`)})
+	msg = readMessage(t, ws)
+	assert.Equal(t, AckMessageType, msg["type"])
+	assert.Equal(t, "2", msg["id"])
+	assert.Equal(t, "hello", msg["body"])
+
+	// command error
+	_ = ws.WriteJSON(CommandMessage{Id: "3", Type: "echo", Body: json.RawMessage(`1`)})
+	msg = readMessage(t, ws)
+	assert.Equal(t, ErrorMessageType, msg["type"])
+	assert.Equal(t, "3", msg["id"])
+	assert.Equal(t, "bad echo", msg["message"])
+
+	// unknown command
+	_ = ws.WriteJSON(CommandMessage{Id: "4", Type: "foobar"})
+	msg = readMessage(t, ws)
+	assert.Equal(t, ErrorMessageType, msg["type"])
+	assert.Equal(t, "4", msg["id"])
+
+	// invalid message
+	_ = ws.WriteMessage(websocket.TextMessage, []byte("foobar"))
+	msg = readMessage(t, ws)
+	assert.Equal(t, ErrorMessageType, msg["type"])
+}
+
+func TestSubscribeCommand(t *testing.T) {
+	sut := newServer()
+	defer sut.Close()
+
+	ws := dial(t, sut, "")
+	defer ws.Close()
+
+	msg := readMessage(t, ws)
+	assert.Equal(t, SequenceMessageType, msg["type"])
+
+	_ = ws.WriteJSON(CommandMessage{Id: "1", Type: SubscribeCommandType, Body: json.RawMessage(`{"types": ["play"]}`)})
+	msg = readMessage(t, ws)
+	assert.Equal(t, AckMessageType, msg["type"])
+
+	svc.BroadcastMessage(testMessage{Type: UpdateSoundMessageType, Text: "updated"})
+	svc.BroadcastMessage(testMessage{Type: PlayMessageType, Text: "played"})
+
+	msg = readMessage(t, ws)
+	assert.Equal(t, PlayMessageType, msg["type"])
+	assert.Equal(t, "played", msg["text"])
+}
+
+func TestReplay(t *testing.T) {
+	sut := newServer()
+	defer sut.Close()
+
+	for i := 0; i < historySize+2; i++ {
+		svc.BroadcastMessage(testMessage{Type: UpdateSoundMessageType, Text: strconv.Itoa(i)})
+	}
+
+	// ephemeral messages are not sequenced
+	svc.BroadcastMessage(testMessage{Type: PlayMessageType})
+
+	// new connection
+	ws := dial(t, sut, "")
+	msg := readMessage(t, ws)
+	assert.Equal(t, SequenceMessageType, msg["type"])
+	assert.Equal(t, float64(historySize+2), msg["seq"])
+	epoch := msg["epoch"].(string)
+	assert.NotEmpty(t, epoch)
+	_ = ws.Close()
+
+	// replay
+	ws = dial(t, sut, fmt.Sprintf("?since=%d&epoch=%s", historySize, epoch))
+	msg = readMessage(t, ws)
+	assert.Equal(t, UpdateSoundMessageType, msg["type"])
+	assert.Equal(t, float64(historySize+1), msg["seq"])
+	assert.Equal(t, epoch, msg["epoch"])
+	assert.Equal(t, strconv.Itoa(historySize), msg["text"])
+	msg = readMessage(t, ws)
+	assert.Equal(t, float64(historySize+2), msg["seq"])
+	_ = ws.Close()
+
+	// up to date
+	ws = dial(t, sut, fmt.Sprintf("?since=%d&epoch=%s", historySize+2, epoch))
+	_ = ws.WriteJSON(CommandMessage{Id: "1", Type: PingCommandType})
+	msg = readMessage(t, ws)
+	assert.Equal(t, AckMessageType, msg["type"])
+	svc.BroadcastMessage(testMessage{Type: DeleteSoundMessageType})
+	msg = readMessage(t, ws)
+	assert.Equal(t, DeleteSoundMessageType, msg["type"])
+	assert.Equal(t, float64(historySize+3), msg["seq"])
+	_ = ws.Close()
+
+	// too far behind
+	ws = dial(t, sut, "?since=1&epoch="+epoch)
+	msg = readMessage(t, ws)
+	assert.Equal(t, ResyncMessageType, msg["type"])
+	assert.Equal(t, float64(historySize+3), msg["seq"])
+	assert.Equal(t, epoch, msg["epoch"])
+	_ = ws.Close()
+
+	// ahead of the server
+	ws = dial(t, sut, fmt.Sprintf("?since=%d&epoch=%s", historySize+10, epoch))
+	msg = readMessage(t, ws)
+	assert.Equal(t, ResyncMessageType, msg["type"])
+	_ = ws.Close()
+
+	// numbered by another replica or before a restart
+	for _, query := range []string{fmt.Sprintf("?since=%d&epoch=other", historySize+2), fmt.Sprintf("?since=%d", historySize+2)} {
+		ws = dial(t, sut, query)
+		msg = readMessage(t, ws)
+		assert.Equal(t, ResyncMessageType, msg["type"])
+		_ = ws.Close()
+	}
+}
+
+func TestSlowConsumer(t *testing.T) {
+	sut := newServer()
+	defer sut.Close()
+
+	// nothing drains the connection's buffer
+	ws := dial(t, sut, "")
+	conn := NewConn(ws, svc, nil)
+
+	dropped := droppedMessages.Value()
+	evicted := evictedConnections.Value()
+
+	for i := 0; i < sendChannelSize+2; i++ {
+		conn.SendMessage(testMessage{Type: UpdateSoundMessageType})
+	}
+
+	assert.Equal(t, dropped+2, droppedMessages.Value())
+	assert.Equal(t, evicted+1, evictedConnections.Value())
+
+	// the connection was closed
+	_, _, err := ws.ReadMessage()
+	assert.Error(t, err)
+}
+
+func TestPresence(t *testing.T) {
+	sut := newServer()
+	defer sut.Close()
+
+	ws := dial(t, sut, "?client=agent")
+	defer ws.Close()
+
+	msg := readMessage(t, ws)
+	assert.Equal(t, SequenceMessageType, msg["type"])
+
+	// our own join
+	_ = ws.SetReadDeadline(time.Now().Add(time.Second))
+	for msg["type"] != PresenceJoinMessageType {
+		msg = nil
+		if err := ws.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Equal(t, "agent", msg["presence"].(map[string]interface{})["client"])
+
+	presence := svc.ListPresence()
+	assert.Len(t, presence, 1)
+	assert.Equal(t, "agent", presence[0].Client)
+
+	w := httptest.NewRecorder()
+	PresenceService{WebsocketService: svc}.listPresence(w, httptest.NewRequest(http.MethodGet, "/presence/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), presence[0].Id)
+}
+
+func TestEvents(t *testing.T) {
+	sut := newServer()
+	defer sut.Close()
+
+	client := http.Client{Timeout: 5 * time.Second}
+
+	resp, err := client.Get(sut.URL + "/events/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+
+	// readEvent returns the id and data of the next event
+	readEvent := func() (id string, data string) {
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			line = strings.TrimSuffix(line, "\n")
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "data: "):
+				data = strings.TrimPrefix(line, "data: ")
+			case line == "" && data != "":
+				return
+			}
+		}
+	}
+
+	var sequence SequenceMessage
+	_, data := readEvent()
+	assert.NoError(t, json.Unmarshal([]byte(data), &sequence))
+	assert.Equal(t, MessageType(SequenceMessageType), sequence.Type)
+
+	svc.BroadcastMessage(testMessage{Type: UpdateSoundMessageType, Text: "updated"})
+
+	for {
+		id, data := readEvent()
+		if id == "" {
+			continue
+		}
+
+		assert.Equal(t, sequence.Epoch+":1", id)
+		assert.Contains(t, data, "updated")
+		break
+	}
+
+	// disconnected clients are unregistered
+	_ = resp.Body.Close()
+	assert.Eventually(t, func() bool { return svc.ConnectionCount() == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestEventsCORS(t *testing.T) {
+	svc = &Service{AuthService: &auth.Service{}, AllowedOrigins: []string{"https://example.com"}}
+
+	router := mux.NewRouter()
+	svc.RegisterRoutes(router)
+
+	sut := httptest.NewServer(handlers.CORS(handlers.AllowedOrigins(svc.AllowedOrigins), handlers.AllowCredentials())(router))
+	defer sut.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, sut.URL+"/events/", nil)
+	req.Header.Set("Origin", "https://example.com")
+
+	client := http.Client{Timeout: 5 * time.Second}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "https://example.com", resp.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", resp.Header.Get("Access-Control-Allow-Credentials"))
+}
+
+func TestPoll(t *testing.T) {
+	sut := newServer()
+	defer sut.Close()
+
+	// open a session
+	session := httpexpect.New(t, sut.URL).
+		GET("/events/poll/").
+		Expect().
+		Status(http.StatusOK).
+		JSON().
+		Object()
+
+	session.Value("messages").Array().First().Object().ValueEqual("type", SequenceMessageType)
+	epoch := session.Value("messages").Array().First().Object().Value("epoch").String().Raw()
+	cursor := session.Value("cursor").String().NotEmpty().Raw()
+
+	svc.BroadcastMessage(testMessage{Type: UpdateSoundMessageType, Text: "updated"})
+
+	// poll the session
+	httpexpect.New(t, sut.URL).
+		GET("/events/poll/").
+		WithQuery("cursor", cursor).
+		Expect().
+		Status(http.StatusOK).
+		JSON().
+		Object().
+		ValueEqual("cursor", cursor).
+		Value("messages").
+		Array().
+		Contains(map[string]interface{}{"epoch": epoch, "seq": 1, "type": UpdateSoundMessageType, "text": "updated"})
+
+	// invalid session
+	httpexpect.New(t, sut.URL).
+		GET("/events/poll/").
+		WithQuery("cursor", "foobar").
+		Expect().
+		Status(http.StatusNotFound)
+}
+
+func TestSubscribeQuery(t *testing.T) {
+	sut := newServer()
+	defer sut.Close()
+
+	ws := dial(t, sut, "?channels=groups&types=delete_sound")
+	defer ws.Close()
+
+	msg := readMessage(t, ws)
+	assert.Equal(t, SequenceMessageType, msg["type"])
+
+	_ = ws.WriteJSON(CommandMessage{Id: "1", Type: PingCommandType})
+	msg = readMessage(t, ws)
+	assert.Equal(t, AckMessageType, msg["type"])
+
+	svc.BroadcastMessage(testMessage{Type: PlayMessageType})
+	svc.BroadcastMessage(testMessage{Type: UpdateSoundMessageType})
+	svc.BroadcastMessage(testMessage{Type: CreateGroupMessageType})
+	svc.BroadcastMessage(testMessage{Type: DeleteSoundMessageType})
+
+	msg = readMessage(t, ws)
+	assert.Equal(t, CreateGroupMessageType, msg["type"])
+	msg = readMessage(t, ws)
+	assert.Equal(t, DeleteSoundMessageType, msg["type"])
+}
+
+func TestSubscribeSounds(t *testing.T) {
+	sut := newServer()
+	defer sut.Close()
+
+	ws := dial(t, sut, "?channels=sounds")
+	defer ws.Close()
+
+	msg := readMessage(t, ws)
+	assert.Equal(t, SequenceMessageType, msg["type"])
+
+	_ = ws.WriteJSON(CommandMessage{Id: "1", Type: PingCommandType})
+	msg = readMessage(t, ws)
+	assert.Equal(t, AckMessageType, msg["type"])
+
+	svc.BroadcastMessage(testMessage{Type: PlayMessageType})
+	svc.BroadcastMessage(testMessage{Type: CreateSoundMessageType})
+
+	msg = readMessage(t, ws)
+	assert.Equal(t, CreateSoundMessageType, msg["type"])
+}
+
+func TestMsgpack(t *testing.T) {
+	var msg map[string]interface{}
+
+	sut := newServer()
+	defer sut.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{msgpackSubprotocol}, EnableCompression: true}
+	ws, _, err := dialer.Dial("ws"+strings.TrimPrefix(sut.URL, "http")+"/ws/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	assert.Equal(t, msgpackSubprotocol, ws.Subprotocol())
+
+	// readBinary returns the next message that is not a connection count or presence change
+	readBinary := func() map[string]interface{} {
+		for {
+			_ = ws.SetReadDeadline(time.Now().Add(time.Second))
+			messageType, data, err := ws.ReadMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, websocket.BinaryMessage, messageType)
+
+			msg = nil
+			if err = msgpack.Unmarshal(data, &msg); err != nil {
+				t.Fatal(err)
+			}
+
+			switch msg["type"] {
+			case ConnectionCountMessageType, PresenceJoinMessageType, PresenceLeaveMessageType:
+				continue
+			}
+
+			return msg
+		}
+	}
+
+	msg = readBinary()
+	assert.Equal(t, SequenceMessageType, msg["type"])
+
+	// commands may be sent as msgpack
+	data, _ := msgpack.Marshal(map[string]interface{}{"id": "1", "type": PingCommandType})
+	_ = ws.WriteMessage(websocket.BinaryMessage, data)
+	msg = readBinary()
+	assert.Equal(t, AckMessageType, msg["type"])
+	assert.Equal(t, "1", msg["id"])
+
+	svc.BroadcastMessage(testMessage{Type: UpdateSoundMessageType, Text: "updated"})
+	msg = readBinary()
+	assert.EqualValues(t, 1, msg["seq"])
+	assert.Equal(t, "updated", msg["text"])
+}
+
+func TestCheckOrigin(t *testing.T) {
+	sut := newServer()
+	defer sut.Close()
+
+	url := "ws" + strings.TrimPrefix(sut.URL, "http") + "/ws/"
+
+	// same origin
+	ws, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": []string{sut.URL}})
+	assert.NoError(t, err)
+	_ = ws.Close()
+
+	// cross origin
+	_, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": []string{"https://example.com"}})
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// allowed cross origin
+	router := mux.NewRouter()
+	(&Service{AuthService: &auth.Service{}, AllowedOrigins: []string{"https://example.com"}}).RegisterRoutes(router)
+	allowed := httptest.NewServer(router)
+	defer allowed.Close()
+
+	url = "ws" + strings.TrimPrefix(allowed.URL, "http") + "/ws/"
+	ws, _, err = websocket.DefaultDialer.Dial(url, http.Header{"Origin": []string{"https://example.com"}})
+	assert.NoError(t, err)
+	_ = ws.Close()
+}
+
+type testScheduledMessage struct {
+	Type      MessageType `json:"type"`
+	Scheduled int64       `json:"scheduled"`
+	Offset    int64       `json:"offset"`
+}
+
+func (m testScheduledMessage) MessageType() MessageType { return m.Type }
+
+func (m testScheduledMessage) WithClockOffset(offset time.Duration) interface{} {
+	m.Offset = int64(offset / time.Millisecond)
+	return m
+}
+
+func TestClockSync(t *testing.T) {
+	sut := newServer()
+	defer sut.Close()
+
+	ws := dial(t, sut, "")
+	defer ws.Close()
+
+	msg := readMessage(t, ws)
+	assert.Equal(t, SequenceMessageType, msg["type"])
+
+	// sync
+	_ = ws.WriteJSON(CommandMessage{Id: "1", Type: ClockSyncCommandType, Body: json.RawMessage(`{"client_time": 1000}`)})
+	msg = readMessage(t, ws)
+	assert.Equal(t, AckMessageType, msg["type"])
+	body := msg["body"].(map[string]interface{})
+	assert.Equal(t, float64(1000), body["client_time"])
+	assert.LessOrEqual(t, body["server_receive"], body["server_transmit"])
+
+	// report offset
+	_ = ws.WriteJSON(CommandMessage{Id: "2", Type: ClockOffsetCommandType, Body: json.RawMessage(`{"offset": 250}`)})
+	msg = readMessage(t, ws)
+	assert.Equal(t, AckMessageType, msg["type"])
+
+	svc.BroadcastMessage(testScheduledMessage{Type: PlayMessageType})
+	msg = readMessage(t, ws)
+	assert.Equal(t, PlayMessageType, msg["type"])
+	assert.Equal(t, float64(250), msg["offset"])
+}
+
+func TestClockSyncFormula(t *testing.T) {
+	sut := newServer()
+	defer sut.Close()
+
+	ws := dial(t, sut, "")
+	defer ws.Close()
+
+	msg := readMessage(t, ws)
+	assert.Equal(t, SequenceMessageType, msg["type"])
+
+	// a client whose clock is an hour ahead
+	skew := time.Hour
+	clientNow := func() int64 { return unixMilli(time.Now().Add(skew)) }
+
+	clientTime := clientNow()
+	_ = ws.WriteJSON(CommandMessage{Id: "1", Type: ClockSyncCommandType, Body: json.RawMessage(fmt.Sprintf(`{"client_time": %d}`, clientTime))})
+	msg = readMessage(t, ws)
+	assert.Equal(t, AckMessageType, msg["type"])
+	clientReceive := clientNow()
+
+	// the formula in docs/asyncapi.yaml
+	body := msg["body"].(map[string]interface{})
+	serverReceive, serverTransmit := int64(body["server_receive"].(float64)), int64(body["server_transmit"].(float64))
+	offset := ((clientTime - serverReceive) + (clientReceive - serverTransmit)) / 2
+	assert.InDelta(t, int64(skew/time.Millisecond), offset, 1000)
+
+	_ = ws.WriteJSON(CommandMessage{Id: "2", Type: ClockOffsetCommandType, Body: json.RawMessage(fmt.Sprintf(`{"offset": %d}`, offset))})
+	msg = readMessage(t, ws)
+	assert.Equal(t, AckMessageType, msg["type"])
+
+	// a sound scheduled now on the server starts now on the client's clock
+	svc.BroadcastMessage(testScheduledMessage{Type: PlayMessageType, Scheduled: unixMilli(time.Now())})
+	msg = readMessage(t, ws)
+	assert.Equal(t, PlayMessageType, msg["type"])
+	assert.InDelta(t, clientNow(), int64(msg["scheduled"].(float64))+int64(msg["offset"].(float64)), 1000)
+}
+
+type testAudioMessage struct {
+	Type    MessageType `json:"type"`
+	SoundId string      `json:"sound_id"`
+}
+
+func (m testAudioMessage) MessageType() MessageType { return m.Type }
+
+func (m testAudioMessage) AudioId() string { return m.SoundId }
+
+func TestStreamAudio(t *testing.T) {
+	sut := newServer()
+	defer sut.Close()
+
+	svc.RegisterAudioSource(func(id string, w io.Writer) error {
+		_, err := w.Write([]byte("audio-" + id))
+		return err
+	})
+
+	ws := dial(t, sut, "?stream_audio=true")
+	defer ws.Close()
+
+	msg := readMessage(t, ws)
+	assert.Equal(t, SequenceMessageType, msg["type"])
+
+	// the other connection already has the sound cached
+	cached := dial(t, sut, "")
+	defer cached.Close()
+
+	msg = readMessage(t, cached)
+	assert.Equal(t, SequenceMessageType, msg["type"])
+
+	_ = cached.WriteJSON(CommandMessage{Id: "1", Type: StreamAudioCommandType, Body: json.RawMessage(`{"enabled": true, "cached": ["a"]}`)})
+	msg = readMessage(t, cached)
+	assert.Equal(t, AckMessageType, msg["type"])
+
+	svc.BroadcastMessage(testAudioMessage{Type: PlayMessageType, SoundId: "a"})
+
+	// audio is sent before the message
+	msg = readMessage(t, ws)
+	assert.Equal(t, AudioMessageType, msg["type"])
+	assert.Equal(t, "a", msg["sound_id"])
+	assert.Equal(t, float64(len("audio-a")), msg["size"])
+
+	messageType, data, err := ws.ReadMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, websocket.BinaryMessage, messageType)
+	assert.Equal(t, "audio-a", string(data))
+
+	msg = readMessage(t, ws)
+	assert.Equal(t, PlayMessageType, msg["type"])
+
+	msg = readMessage(t, cached)
+	assert.Equal(t, PlayMessageType, msg["type"])
+
+	// audio is only sent once per connection
+	svc.BroadcastMessage(testAudioMessage{Type: PlayMessageType, SoundId: "a"})
+	msg = readMessage(t, ws)
+	assert.Equal(t, PlayMessageType, msg["type"])
+}
+
+func TestSlowAudioSource(t *testing.T) {
+	sut := newServer()
+	defer sut.Close()
+
+	release := make(chan struct{})
+	defer close(release)
+
+	svc.RegisterAudioSource(func(id string, w io.Writer) error {
+		<-release
+		_, err := w.Write([]byte("audio-" + id))
+		return err
+	})
+
+	ws := dial(t, sut, "?stream_audio=true")
+	defer ws.Close()
+
+	msg := readMessage(t, ws)
+	assert.Equal(t, SequenceMessageType, msg["type"])
+
+	// broadcasts do not wait for the audio to be read
+	done := make(chan struct{})
+	go func() {
+		svc.BroadcastMessage(testAudioMessage{Type: PlayMessageType, SoundId: "a"})
+		svc.BroadcastMessage(testMessage{Type: UpdateSoundMessageType, Text: "updated"})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("broadcast blocked on the audio source")
+	}
+}
+
+func TestCluster(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pubSub := &cluster.MemoryPubSub{}
+
+	// replica a
+	sut := newServer()
+	defer sut.Close()
+	a := svc
+	a.Cluster = cluster.New(pubSub, cluster.StaticElector{IsLeader: true})
+	a.RegisterMessage(UpdateSoundMessageType, func() Message { return &testMessage{} })
+	assert.NoError(t, a.subscribe(ctx))
+
+	// replica b
+	sut2 := newServer()
+	defer sut2.Close()
+	b := svc
+	b.Cluster = cluster.New(pubSub, cluster.StaticElector{})
+	assert.NoError(t, b.subscribe(ctx))
+
+	wsA := dial(t, sut, "")
+	assert.Equal(t, SequenceMessageType, readMessage(t, wsA)["type"])
+	defer wsA.Close()
+
+	wsB := dial(t, sut2, "")
+	assert.Equal(t, SequenceMessageType, readMessage(t, wsB)["type"])
+	defer wsB.Close()
+
+	// messages from either replica reach every connection
+	b.BroadcastMessage(testMessage{Type: UpdateSoundMessageType, Text: "b"})
+	for _, ws := range []*websocket.Conn{wsA, wsB} {
+		msg := readMessage(t, ws)
+		assert.Equal(t, UpdateSoundMessageType, msg["type"])
+		assert.Equal(t, "b", msg["text"])
+		assert.Equal(t, float64(1), msg["seq"])
+	}
+
+	// unregistered types are passed through
+	a.BroadcastMessage(testMessage{Type: DeleteSoundMessageType, Text: "a"})
+	msg := readMessage(t, wsB)
+	assert.Equal(t, DeleteSoundMessageType, msg["type"])
+	assert.Equal(t, "a", msg["text"])
+
+	// connection counts are per replica
+	assert.Equal(t, 1, a.ConnectionCount())
+	assert.Equal(t, 1, b.ConnectionCount())
+}
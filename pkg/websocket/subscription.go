@@ -0,0 +1,112 @@
+package websocket
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	// query parameters clients use to limit the messages they receive
+	typesParameterName    = "types"
+	channelsParameterName = "channels"
+)
+
+// Channel is a group of related message types clients can subscribe to.
+type Channel string
+
+const (
+	PlaybackChannel Channel = "playback"
+	SoundChannel    Channel = "sounds"
+	GroupChannel    Channel = "groups"
+	PresenceChannel Channel = "presence"
+)
+
+var messageChannels = map[MessageType]Channel{
+	PlayMessageType:            PlaybackChannel,
+	CreateSoundMessageType:     SoundChannel,
+	UpdateSoundMessageType:     SoundChannel,
+	DeleteSoundMessageType:     SoundChannel,
+	CreateGroupMessageType:     GroupChannel,
+	UpdateGroupMessageType:     GroupChannel,
+	DeleteGroupMessageType:     GroupChannel,
+	ConnectionCountMessageType: PresenceChannel,
+	PresenceJoinMessageType:    PresenceChannel,
+	PresenceLeaveMessageType:   PresenceChannel,
+}
+
+// Subscription is the set of message types and channels a connection receives. A subscription without types or
+// channels receives every message.
+type Subscription struct {
+	Types    []MessageType `json:"types"`
+	Channels []Channel     `json:"channels"`
+}
+
+// parseSubscription reads a subscription from comma separated query parameters.
+func parseSubscription(r *http.Request) Subscription {
+	var subscription Subscription
+
+	for _, v := range splitQuery(r, typesParameterName) {
+		subscription.Types = append(subscription.Types, MessageType(v))
+	}
+
+	for _, v := range splitQuery(r, channelsParameterName) {
+		subscription.Channels = append(subscription.Channels, Channel(v))
+	}
+
+	return subscription
+}
+
+func splitQuery(r *http.Request, name string) []string {
+	var rval []string
+
+	for _, value := range r.URL.Query()[name] {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				rval = append(rval, v)
+			}
+		}
+	}
+
+	return rval
+}
+
+// subscriptionFilter is the lookup form of a subscription.
+type subscriptionFilter struct {
+	types    map[MessageType]bool
+	channels map[Channel]bool
+}
+
+func newSubscriptionFilter(subscription Subscription) *subscriptionFilter {
+	if len(subscription.Types) == 0 && len(subscription.Channels) == 0 {
+		return nil
+	}
+
+	f := &subscriptionFilter{
+		types:    make(map[MessageType]bool, len(subscription.Types)),
+		channels: make(map[Channel]bool, len(subscription.Channels)),
+	}
+
+	for i := range subscription.Types {
+		f.types[subscription.Types[i]] = true
+	}
+
+	for i := range subscription.Channels {
+		f.channels[subscription.Channels[i]] = true
+	}
+
+	return f
+}
+
+func (f *subscriptionFilter) allows(messageType MessageType) bool {
+	if f == nil {
+		return true
+	}
+
+	if f.types[messageType] {
+		return true
+	}
+
+	channel, ok := messageChannels[messageType]
+
+	return ok && f.channels[channel]
+}